@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultStopTimeout bounds each component's Stop when no timeout is set.
+const DefaultStopTimeout = 30 * time.Second
+
+// Component is a unit with a managed lifecycle. Start must return once the
+// component is running; work that outlives Start belongs in goroutines that
+// Stop ends. Stop must return when its context expires.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// ErrorReporter is implemented by components that can fail after Start
+// returns. A value on the channel triggers shutdown of the whole App.
+type ErrorReporter interface {
+	Errors() <-chan error
+}
+
+// ErrDependency is returned by Run when dependencies are unknown or cyclic.
+var ErrDependency = errors.New("app: invalid dependency")
+
+// Option configures a registered component.
+type Option func(*entry)
+
+// WithStopTimeout sets how long the component may take to stop.
+func WithStopTimeout(d time.Duration) Option {
+	return func(e *entry) {
+		e.stopTimeout = d
+	}
+}
+
+// DependsOn declares components that must be started before this one and
+// stopped after it.
+func DependsOn(names ...string) Option {
+	return func(e *entry) {
+		e.dependsOn = append(e.dependsOn, names...)
+	}
+}
+
+type entry struct {
+	name        string
+	component   Component
+	stopTimeout time.Duration
+	dependsOn   []string
+}
+
+// App starts components in dependency order and stops them in reverse.
+type App struct {
+	entries []*entry
+	logger  *log.Logger
+}
+
+// New creates an empty App that logs lifecycle events to logger, or to the
+// standard logger when logger is nil.
+func New(logger *log.Logger) *App {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &App{logger: logger}
+}
+
+// Add registers a component under name. Without dependencies, components
+// start in registration order.
+func (a *App) Add(name string, c Component, opts ...Option) {
+	e := &entry{name: name, component: c, stopTimeout: DefaultStopTimeout}
+	for _, opt := range opts {
+		opt(e)
+	}
+	a.entries = append(a.entries, e)
+}
+
+// Run starts every component and blocks until ctx is canceled or a
+// component fails, then stops the started components in reverse order. It
+// returns the failure that caused shutdown, if any, joined with stop errors.
+func (a *App) Run(ctx context.Context) error {
+	order, err := a.order()
+	if err != nil {
+		return err
+	}
+
+	failures := make(chan error, len(order))
+	var started []*entry
+	var runErr error
+
+	for _, e := range order {
+		a.logger.Printf("app: starting %s", e.name)
+		if err := e.component.Start(ctx); err != nil {
+			runErr = fmt.Errorf("starting %s: %w", e.name, err)
+			break
+		}
+		started = append(started, e)
+		if r, ok := e.component.(ErrorReporter); ok {
+			go forward(e.name, r.Errors(), failures)
+		}
+	}
+
+	if runErr == nil {
+		select {
+		case <-ctx.Done():
+		case runErr = <-failures:
+		}
+	}
+	if runErr != nil {
+		a.logger.Printf("app: %v", runErr)
+	}
+
+	return errors.Join(runErr, a.stop(started))
+}
+
+// forward relays the first error from a component to failures.
+func forward(name string, errs <-chan error, failures chan<- error) {
+	if err, ok := <-errs; ok && err != nil {
+		failures <- fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+// stop stops entries in reverse order, each within its own timeout.
+func (a *App) stop(entries []*entry) error {
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		a.logger.Printf("app: stopping %s", e.name)
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.stopTimeout)
+		if err := e.component.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", e.name, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// order sorts entries so that every component follows its dependencies,
+// keeping registration order otherwise.
+func (a *App) order() ([]*entry, error) {
+	byName := make(map[string]*entry, len(a.entries))
+	for _, e := range a.entries {
+		if _, ok := byName[e.name]; ok {
+			return nil, fmt.Errorf("%w: duplicate component %q", ErrDependency, e.name)
+		}
+		byName[e.name] = e
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(a.entries))
+	order := make([]*entry, 0, len(a.entries))
+
+	var visit func(e *entry) error
+	visit = func(e *entry) error {
+		switch state[e.name] {
+		case visiting:
+			return fmt.Errorf("%w: cycle through %q", ErrDependency, e.name)
+		case done:
+			return nil
+		}
+		state[e.name] = visiting
+		for _, dep := range e.dependsOn {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("%w: %q depends on unknown component %q", ErrDependency, e.name, dep)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[e.name] = done
+		order = append(order, e)
+		return nil
+	}
+
+	for _, e := range a.entries {
+		if err := visit(e); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
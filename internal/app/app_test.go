@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder logs lifecycle calls across components.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (r *recorder) component(name string, startErr error) Hook {
+	return Hook{
+		OnStart: func(context.Context) error {
+			r.record("start " + name)
+			return startErr
+		},
+		OnStop: func(context.Context) error {
+			r.record("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	rec := &recorder{}
+	a := New(nil)
+	a.Add("server", rec.component("server", nil), DependsOn("db", "cache"))
+	a.Add("cache", rec.component("cache", nil), DependsOn("db"))
+	a.Add("db", rec.component("db", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Run(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"start db", "start cache", "start server", "stop server", "stop cache", "stop db"}
+	if got := rec.get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestRunStartFailure(t *testing.T) {
+	rec := &recorder{}
+	boom := errors.New("boom")
+	a := New(nil)
+	a.Add("first", rec.component("first", nil))
+	a.Add("second", rec.component("second", boom))
+	a.Add("third", rec.component("third", nil))
+
+	err := a.Run(context.Background())
+	if !errors.Is(err, boom) {
+		t.Errorf("Expected start error, got %v", err)
+	}
+
+	expected := []string{"start first", "start second", "stop first"}
+	if got := rec.get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestRunComponentFailure(t *testing.T) {
+	rec := &recorder{}
+	boom := errors.New("boom")
+	a := New(nil)
+	a.Add("other", rec.component("other", nil))
+	a.Add("worker", NewWorker(func(ctx context.Context) error {
+		return boom
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- a.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, boom) {
+			t.Errorf("Expected worker error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a failing component to stop the app")
+	}
+
+	if got := rec.get(); len(got) != 2 || got[1] != "stop other" {
+		t.Errorf("Expected other component to be stopped, got %v", got)
+	}
+}
+
+func TestRunStopTimeout(t *testing.T) {
+	a := New(nil)
+	a.Add("stuck", Hook{OnStop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}, WithStopTimeout(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRunInvalidDependencies(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(a *App)
+	}{
+		{"unknown", func(a *App) {
+			a.Add("a", Hook{}, DependsOn("missing"))
+		}},
+		{"cycle", func(a *App) {
+			a.Add("a", Hook{}, DependsOn("b"))
+			a.Add("b", Hook{}, DependsOn("a"))
+		}},
+		{"duplicate", func(a *App) {
+			a.Add("a", Hook{})
+			a.Add("a", Hook{})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(nil)
+			tt.setup(a)
+			if err := a.Run(context.Background()); !errors.Is(err, ErrDependency) {
+				t.Errorf("Expected ErrDependency, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	srv := NewHTTPServer(&http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}, nil)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.Stop(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// An address already in use fails in Start rather than later.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	busy := NewHTTPServer(&http.Server{Addr: ln.Addr().String()}, nil)
+	if err := busy.Start(context.Background()); err == nil {
+		t.Error("Expected error starting on a busy address")
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Hook adapts a pair of functions to a Component. Either may be nil.
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Start calls OnStart.
+func (h Hook) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+// Stop calls OnStop.
+func (h Hook) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// Worker runs a function in the background from Start until Stop cancels
+// its context. A non-nil error returned before Stop is reported as a failure.
+type Worker struct {
+	run    func(ctx context.Context) error
+	cancel context.CancelFunc
+	done   chan struct{}
+	errs   chan error
+}
+
+// NewWorker creates a Worker for run.
+func NewWorker(run func(ctx context.Context) error) *Worker {
+	return &Worker{run: run, errs: make(chan error, 1)}
+}
+
+// Start launches run in a goroutine.
+func (w *Worker) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	go func() {
+		defer close(w.done)
+		if err := w.run(ctx); err != nil && ctx.Err() == nil {
+			w.errs <- err
+		}
+	}()
+	return nil
+}
+
+// Stop cancels run and waits for it to return.
+func (w *Worker) Stop(ctx context.Context) error {
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Errors implements ErrorReporter.
+func (w *Worker) Errors() <-chan error {
+	return w.errs
+}
+
+// HTTPServer runs an http.Server as a Component. Unless a listener is
+// supplied, it is opened in Start, so address conflicts surface before
+// dependent components start. The server speaks TLS when srv.TLSConfig is
+// set.
+type HTTPServer struct {
+	srv  *http.Server
+	ln   net.Listener
+	errs chan error
+}
+
+// NewHTTPServer wraps srv. When ln is nil, Start listens on srv.Addr.
+func NewHTTPServer(srv *http.Server, ln net.Listener) *HTTPServer {
+	return &HTTPServer{srv: srv, ln: ln, errs: make(chan error, 1)}
+}
+
+// Start opens the listener if needed and serves in the background.
+func (s *HTTPServer) Start(ctx context.Context) error {
+	ln := s.ln
+	if ln == nil {
+		var lc net.ListenConfig
+		var err error
+		if ln, err = lc.Listen(ctx, "tcp", s.srv.Addr); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		var err error
+		if s.srv.TLSConfig != nil {
+			// Certificates come from srv.TLSConfig
+			err = s.srv.ServeTLS(ln, "", "")
+		} else {
+			err = s.srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errs <- err
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully shuts the server down.
+func (s *HTTPServer) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// Errors implements ErrorReporter.
+func (s *HTTPServer) Errors() <-chan error {
+	return s.errs
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader carries the API key on requests.
+const APIKeyHeader = "X-API-Key"
+
+// MethodAPIKey is the Principal.Method for API key authentication.
+const MethodAPIKey = "api_key"
+
+// hashPrefix marks the hash algorithm in key files.
+const hashPrefix = "sha256:"
+
+// APIKey is a named API key as stored in a key file. Only the hash of the
+// key is stored; keys are random, so a fast hash is sufficient.
+type APIKey struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	// ExpiresAt is optional; the zero time never expires.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// HashKey returns the key file hash of key.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// KeyStore authenticates requests by API key.
+type KeyStore struct {
+	keys   []APIKey
+	hashes [][]byte
+	now    func() time.Time
+}
+
+// NewKeyStore validates keys and returns a store for them.
+func NewKeyStore(keys []APIKey) (*KeyStore, error) {
+	s := &KeyStore{now: time.Now}
+	names := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.Name == "" {
+			return nil, errors.New("API key without a name")
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("duplicate API key name %q", k.Name)
+		}
+		names[k.Name] = true
+
+		hexHash, ok := strings.CutPrefix(k.Hash, hashPrefix)
+		hash, err := hex.DecodeString(hexHash)
+		if !ok || err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be %q followed by 64 hex digits", k.Name, hashPrefix)
+		}
+		s.keys = append(s.keys, k)
+		s.hashes = append(s.hashes, hash)
+	}
+	return s, nil
+}
+
+// LoadKeyStore reads a JSON array of APIKey from path, typically a mounted
+// secret.
+func LoadKeyStore(path string) (*KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys %s: %w", path, err)
+	}
+	return NewKeyStore(keys)
+}
+
+// Challenge implements Authenticator.
+func (s *KeyStore) Challenge() string {
+	return `ApiKey realm="api"`
+}
+
+// Authenticate implements Authenticator using the X-API-Key header. Every
+// stored hash is compared in constant time so timing does not reveal which
+// keys exist.
+func (s *KeyStore) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	match := -1
+	for i, hash := range s.hashes {
+		if subtle.ConstantTimeCompare(sum[:], hash) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	k := s.keys[match]
+	if !k.ExpiresAt.IsZero() && !s.now().Before(k.ExpiresAt) {
+		return nil, ErrExpiredCredentials
+	}
+	return &Principal{
+		Name:      k.Name,
+		Method:    MethodAPIKey,
+		Scopes:    k.Scopes,
+		Roles:     k.Roles,
+		ExpiresAt: k.ExpiresAt,
+	}, nil
+}
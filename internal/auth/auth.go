@@ -0,0 +1,111 @@
+// Package auth authenticates API requests and carries the authenticated
+// principal through the request context.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/eminent85/go-app/internal/middleware"
+)
+
+// Authentication errors. ErrNoCredentials means the request carries no
+// credentials for an Authenticator, so the next one is tried.
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrExpiredCredentials = errors.New("credentials expired")
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Name      string    `json:"name"`
+	Method    string    `json:"method"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Claims holds every token claim for JWT principals.
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether the principal holds role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// Authenticator authenticates a request from one kind of credential.
+type Authenticator interface {
+	// Authenticate returns the principal for r, or ErrNoCredentials if r
+	// carries no credentials of this kind.
+	Authenticate(r *http.Request) (*Principal, error)
+	// Challenge returns the WWW-Authenticate value sent on 401 responses.
+	Challenge() string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal authenticated for the request.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Require authenticates every request with the first authenticator whose
+// credentials it carries, rejecting it with 401 if there are none or they
+// are invalid. The principal is stored in the request context and added to
+// the request log.
+func Require(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return &guard{policy: Policy{Authenticated: true}, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					unauthorized(w, err, authenticators)
+					return
+				}
+
+				middleware.SetLogPrincipal(w, p.Name)
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+				return
+			}
+			unauthorized(w, ErrNoCredentials, authenticators)
+		})}
+	}
+}
+
+// unauthorized writes a 401 response challenging for every accepted kind of
+// credential. The error is generic so responses do not reveal which keys
+// exist or why a token was rejected.
+func unauthorized(w http.ResponseWriter, err error, authenticators []Authenticator) {
+	message := "Unauthorized"
+	if errors.Is(err, ErrExpiredCredentials) {
+		message = "Credentials expired"
+	}
+	for _, a := range authenticators {
+		w.Header().Add("WWW-Authenticate", a.Challenge())
+	}
+	writeJSON(w, http.StatusUnauthorized, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
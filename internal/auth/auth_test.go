@@ -0,0 +1,710 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewKeyStore(t *testing.T) {
+	valid := HashKey("secret")
+
+	tests := []struct {
+		name    string
+		keys    []APIKey
+		wantErr bool
+	}{
+		{name: "valid", keys: []APIKey{{Name: "ci", Hash: valid}}},
+		{name: "missing name", keys: []APIKey{{Hash: valid}}, wantErr: true},
+		{name: "duplicate name", keys: []APIKey{{Name: "ci", Hash: valid}, {Name: "ci", Hash: valid}}, wantErr: true},
+		{name: "missing prefix", keys: []APIKey{{Name: "ci", Hash: strings.TrimPrefix(valid, "sha256:")}}, wantErr: true},
+		{name: "short hash", keys: []APIKey{{Name: "ci", Hash: "sha256:abcd"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyStore(tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKeyStoreAuthenticate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store, err := NewKeyStore([]APIKey{
+		{Name: "ci", Hash: HashKey("ci-key"), Scopes: []string{"items:read"}},
+		{Name: "old", Hash: HashKey("old-key"), ExpiresAt: now},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		key      string
+		expected error
+	}{
+		{name: "valid key", key: "ci-key"},
+		{name: "no key", key: "", expected: ErrNoCredentials},
+		{name: "unknown key", key: "guess", expected: ErrInvalidCredentials},
+		{name: "expired key", key: "old-key", expected: ErrExpiredCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+
+			p, err := store.Authenticate(req)
+			if err != tt.expected {
+				t.Fatalf("Expected error %v, got %v", tt.expected, err)
+			}
+			if err == nil && (p.Name != "ci" || p.Method != MethodAPIKey || !p.HasScope("items:read")) {
+				t.Errorf("Unexpected principal: %+v", p)
+			}
+		})
+	}
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `[{"name": "ci", "hash": "` + HashKey("ci-key") + `", "expires_at": "2099-01-01T00:00:00Z"}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write keys: %v", err)
+	}
+
+	store, err := LoadKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set(APIKeyHeader, "ci-key")
+	if _, err := store.Authenticate(req); err != nil {
+		t.Errorf("Expected key to authenticate, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("Failed to write keys: %v", err)
+	}
+	if _, err := LoadKeyStore(path); err == nil {
+		t.Error("Expected error for invalid key file")
+	}
+	if _, err := LoadKeyStore(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing key file")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	store, err := NewKeyStore([]APIKey{{Name: "ci", Hash: HashKey("ci-key")}})
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+	handler := Require(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			t.Error("Expected principal in context")
+			return
+		}
+		_, _ = w.Write([]byte(p.Name))
+	}))
+
+	tests := []struct {
+		name     string
+		key      string
+		expected int
+	}{
+		{name: "authenticated", key: "ci-key", expected: http.StatusOK},
+		{name: "missing key", expected: http.StatusUnauthorized},
+		{name: "invalid key", key: "guess", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if tt.expected == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate header")
+			}
+			if tt.expected == http.StatusOK && w.Body.String() != "ci" {
+				t.Errorf("Expected principal ci, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+
+	tests := []struct {
+		name      string
+		guard     func(http.Handler) http.Handler
+		principal *Principal
+		expected  int
+	}{
+		{name: "granted", guard: RequireScopes("orders:read", "orders:write"),
+			principal: &Principal{Scopes: []string{"orders:read", "orders:write"}}, expected: http.StatusOK},
+		{name: "missing scope", guard: RequireScopes("orders:read", "orders:write"),
+			principal: &Principal{Scopes: []string{"orders:read"}}, expected: http.StatusForbidden},
+		{name: "role granted", guard: RequireRoles("admin"),
+			principal: &Principal{Roles: []string{"admin"}}, expected: http.StatusOK},
+		{name: "scope is not a role", guard: RequireRoles("admin"),
+			principal: &Principal{Scopes: []string{"admin"}}, expected: http.StatusForbidden},
+		{name: "no principal", guard: RequireScopes("orders:read"), expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+			}
+			w := httptest.NewRecorder()
+			tt.guard(ok).ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if tt.expected == http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Expected problem+json, got %q", ct)
+			}
+			if tt.expected == http.StatusForbidden {
+				if !strings.Contains(w.Body.String(), "Missing required") {
+					t.Errorf("Expected missing permissions in body, got %q", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	store, err := NewKeyStore(nil)
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+	ok := func(http.ResponseWriter, *http.Request) {}
+
+	r := chi.NewRouter()
+	r.Get("/health", ok)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(Require(store))
+		r.Get("/orders", ok)
+		r.With(RequireScopes("orders:write")).Post("/orders", ok)
+		r.Group(func(r chi.Router) {
+			r.Use(RequireRoles("admin"))
+			r.With(RequireScopes("orders:write", "orders:delete")).Delete("/orders/{id}", ok)
+		})
+	})
+
+	routes, err := Routes(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []RoutePolicy{
+		{Method: http.MethodGet, Pattern: "/api/orders", Policy: Policy{Authenticated: true}},
+		{Method: http.MethodPost, Pattern: "/api/orders", Policy: Policy{Authenticated: true, Scopes: []string{"orders:write"}}},
+		{Method: http.MethodDelete, Pattern: "/api/orders/{id}", Policy: Policy{
+			Authenticated: true, Scopes: []string{"orders:write", "orders:delete"}, Roles: []string{"admin"},
+		}},
+		{Method: http.MethodGet, Pattern: "/health"},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected routes %+v, got %+v", expected, routes)
+	}
+}
+
+// testIssuer signs tokens and serves their keys from a local JWKS endpoint.
+type testIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+	// down makes the JWKS endpoint fail, after waiting for hold when set.
+	down bool
+	hold chan struct{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": iss.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		iss.mu.Lock()
+		iss.fetches++
+		down, hold := iss.down, iss.hold
+		keys := iss.keys
+		iss.mu.Unlock()
+
+		if down {
+			if hold != nil {
+				<-hold
+			}
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+// publish replaces the served keys.
+func (iss *testIssuer) publish(keys ...map[string]string) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys = keys
+}
+
+// outage makes the JWKS endpoint fail, holding each fetch until hold is
+// closed.
+func (iss *testIssuer) outage(hold chan struct{}) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.down = true
+	iss.hold = hold
+}
+
+func (iss *testIssuer) fetchCount() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.fetches
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// testKey is a signing key and its JWK.
+type testKey struct {
+	alg  string
+	priv crypto.Signer
+	jwk  map[string]string
+}
+
+func newTestKey(t *testing.T, alg, kid string) testKey {
+	t.Helper()
+	switch alg {
+	case "RS256":
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		e := big.NewInt(int64(priv.E)).Bytes()
+		return testKey{alg, priv, map[string]string{"kty": "RSA", "kid": kid, "n": b64(priv.N.Bytes()), "e": b64(e)}}
+	case "ES256":
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		point, _ := priv.PublicKey.Bytes()
+		return testKey{alg, priv, map[string]string{
+			"kty": "EC", "crv": "P-256", "kid": kid, "x": b64(point[1:33]), "y": b64(point[33:]),
+		}}
+	default:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		return testKey{"EdDSA", priv, map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": kid, "x": b64(pub)}}
+	}
+}
+
+// sign returns a compact JWS of claims with header alg overridden by alg
+// when it is not empty.
+func (k testKey) sign(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+	if alg == "" {
+		alg = k.alg
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": k.jwk["kid"], "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+
+	var sig []byte
+	sum := sha256.Sum256([]byte(input))
+	switch priv := k.priv.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, priv, sum[:])
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(priv, []byte(input))
+	}
+	return input + "." + b64(sig)
+}
+
+func newTestVerifier(t *testing.T, iss *testIssuer, jwksURL string, now time.Time) *JWTVerifier {
+	t.Helper()
+	v, err := NewJWTVerifier(JWTOptions{
+		JWKSURL:   jwksURL,
+		Issuer:    iss.server.URL,
+		Audience:  "go-app",
+		ClockSkew: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	v.now = func() time.Time { return now }
+	v.keys.now = v.now
+	return v
+}
+
+func bearer(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTVerifier(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	iss := newTestIssuer(t)
+	rsaKey := newTestKey(t, "RS256", "rsa")
+	ecKey := newTestKey(t, "ES256", "ec")
+	edKey := newTestKey(t, "EdDSA", "ed")
+	iss.publish(rsaKey.jwk, ecKey.jwk, edKey.jwk)
+	v := newTestVerifier(t, iss, iss.server.URL+"/jwks", now)
+
+	valid := func(changes map[string]any) map[string]any {
+		claims := map[string]any{
+			"iss":   iss.server.URL,
+			"sub":   "user-1",
+			"aud":   "go-app",
+			"exp":   now.Add(time.Hour).Unix(),
+			"nbf":   now.Add(-time.Minute).Unix(),
+			"scope": "items:read items:write",
+		}
+		for k, val := range changes {
+			if val == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = val
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{name: "RS256", token: rsaKey.sign(t, "", valid(nil))},
+		{name: "ES256", token: ecKey.sign(t, "", valid(nil))},
+		{name: "EdDSA", token: edKey.sign(t, "", valid(nil))},
+		{name: "audience array", token: rsaKey.sign(t, "", valid(map[string]any{"aud": []string{"other", "go-app"}}))},
+		{name: "expired within skew", token: rsaKey.sign(t, "", valid(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{
+			name:     "expired",
+			token:    rsaKey.sign(t, "", valid(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})),
+			expected: ErrExpiredCredentials,
+		},
+		{
+			name:     "not yet valid",
+			token:    rsaKey.sign(t, "", valid(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})),
+			expected: ErrInvalidCredentials,
+		},
+		{name: "missing exp", token: rsaKey.sign(t, "", valid(map[string]any{"exp": nil})), expected: ErrInvalidCredentials},
+		{name: "wrong issuer", token: rsaKey.sign(t, "", valid(map[string]any{"iss": "https://evil.example"})), expected: ErrInvalidCredentials},
+		{name: "wrong audience", token: rsaKey.sign(t, "", valid(map[string]any{"aud": "other"})), expected: ErrInvalidCredentials},
+		{name: "algorithm mismatch", token: rsaKey.sign(t, "HS256", valid(nil)), expected: ErrInvalidCredentials},
+		{name: "tampered", token: rsaKey.sign(t, "", valid(nil)) + "x", expected: ErrInvalidCredentials},
+		{name: "malformed", token: "not-a-jwt", expected: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Authenticate(bearer(tt.token))
+			if tt.expected != nil {
+				if !errors.Is(err, tt.expected) {
+					t.Errorf("Expected error %v, got %v", tt.expected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if p.Name != "user-1" || p.Method != MethodJWT || !p.HasScope("items:write") {
+				t.Errorf("Unexpected principal: %+v", p)
+			}
+			if p.Claims["sub"] != "user-1" {
+				t.Errorf("Expected claims on principal, got %v", p.Claims)
+			}
+		})
+	}
+
+	if _, err := v.Authenticate(httptest.NewRequest(http.MethodGet, "/", http.NoBody)); err != ErrNoCredentials {
+		t.Errorf("Expected ErrNoCredentials without a token, got %v", err)
+	}
+	if got := iss.fetchCount(); got != 1 {
+		t.Errorf("Expected keys to be fetched once, got %d", got)
+	}
+}
+
+func TestJWTVerifierKeyRotation(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	iss := newTestIssuer(t)
+	oldKey := newTestKey(t, "EdDSA", "old")
+	newKey := newTestKey(t, "EdDSA", "new")
+	iss.publish(oldKey.jwk)
+	v := newTestVerifier(t, iss, "", now)
+	v.now = func() time.Time { return now }
+	v.keys.now = v.now
+
+	claims := map[string]any{"iss": iss.server.URL, "sub": "user-1", "aud": "go-app", "exp": now.Add(time.Hour).Unix()}
+
+	// Keys are discovered from the issuer on first use
+	if _, err := v.Authenticate(bearer(oldKey.sign(t, "", claims))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A token signed with a rotated key triggers a refresh, at most once
+	// per minimum refresh interval
+	iss.publish(oldKey.jwk, newKey.jwk)
+	now = now.Add(minRefreshInterval)
+	if _, err := v.Authenticate(bearer(newKey.sign(t, "", claims))); err != nil {
+		t.Fatalf("Expected rotated key to be fetched, got %v", err)
+	}
+	if got := iss.fetchCount(); got != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", got)
+	}
+
+	// Unknown key IDs do not refetch again within the minimum interval
+	unknown := newTestKey(t, "EdDSA", "unknown")
+	if _, err := v.Authenticate(bearer(unknown.sign(t, "", claims))); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for unknown key, got %v", err)
+	}
+	if got := iss.fetchCount(); got != 2 {
+		t.Errorf("Expected no extra JWKS fetch, got %d fetches", got)
+	}
+}
+
+// waitForRefresh waits for the verifier's background key refresh, if any.
+func waitForRefresh(v *JWTVerifier) {
+	v.keys.mu.Lock()
+	done := v.keys.refreshing
+	v.keys.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func TestJWTVerifierJWKSOutage(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	iss := newTestIssuer(t)
+	key := newTestKey(t, "EdDSA", "key")
+	iss.publish(key.jwk)
+	v := newTestVerifier(t, iss, iss.server.URL+"/jwks", now)
+	v.now = func() time.Time { return now }
+	v.keys.now = v.now
+
+	token := key.sign(t, "", map[string]any{"iss": iss.server.URL, "sub": "user-1", "aud": "go-app", "exp": now.Add(3 * time.Hour).Unix()})
+	if _, err := v.Authenticate(bearer(token)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Once the keys are stale, requests keep using them without waiting
+	// for the hanging refresh
+	hold := make(chan struct{})
+	iss.outage(hold)
+	now = now.Add(time.Hour)
+	for i := 0; i < 100; i++ {
+		if _, err := v.Authenticate(bearer(token)); err != nil {
+			t.Fatalf("Expected stale key to be used, got %v", err)
+		}
+	}
+	close(hold)
+	waitForRefresh(v)
+	if got := iss.fetchCount(); got != 2 {
+		t.Errorf("Expected a single refresh during the outage, got %d fetches", got)
+	}
+
+	// The failed refresh is retried only after the minimum interval
+	for i := 0; i < 100; i++ {
+		if _, err := v.Authenticate(bearer(token)); err != nil {
+			t.Fatalf("Expected stale key to be used, got %v", err)
+		}
+	}
+	if got := iss.fetchCount(); got != 2 {
+		t.Errorf("Expected no retry within the minimum interval, got %d fetches", got)
+	}
+	now = now.Add(minRefreshInterval)
+	if _, err := v.Authenticate(bearer(token)); err != nil {
+		t.Fatalf("Expected stale key to be used, got %v", err)
+	}
+	waitForRefresh(v)
+	if got := iss.fetchCount(); got != 3 {
+		t.Errorf("Expected a retry after the minimum interval, got %d fetches", got)
+	}
+}
+
+func TestRequireChallenges(t *testing.T) {
+	store, _ := NewKeyStore(nil)
+	v, err := NewJWTVerifier(JWTOptions{Issuer: "https://issuer.example", Audience: "go-app"})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	handler := Require(store, v)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("Expected request to be rejected")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if got := w.Header().Values("WWW-Authenticate"); len(got) != 2 {
+		t.Errorf("Expected a challenge per authenticator, got %v", got)
+	}
+}
+
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewWebhookVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		partners []WebhookPartner
+	}{
+		{name: "missing name", partners: []WebhookPartner{{Secrets: []string{"s"}}}},
+		{name: "duplicate name", partners: []WebhookPartner{
+			{Name: "acme", Secrets: []string{"s"}},
+			{Name: "acme", Secrets: []string{"t"}},
+		}},
+		{name: "no secrets", partners: []WebhookPartner{{Name: "acme"}}},
+		{name: "empty secret", partners: []WebhookPartner{{Name: "acme", Secrets: []string{""}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebhookVerifier(WebhookOptions{Partners: tt.partners}); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestVerifyWebhooks(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v, err := NewWebhookVerifier(WebhookOptions{
+		Partners:     []WebhookPartner{{Name: "acme", Secrets: []string{"new-secret", "old-secret"}}},
+		MaxBodyBytes: 64,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	v.now = func() time.Time { return now }
+
+	handler := VerifyWebhooks(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(p.Name + ":" + string(body)))
+	}))
+
+	ts := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	replayed := sign("new-secret", ts, "replayed")
+
+	tests := []struct {
+		name      string
+		partner   string
+		timestamp string
+		signature string
+		body      string
+		expected  int
+	}{
+		{name: "valid", partner: "acme", timestamp: ts, signature: sign("new-secret", ts, "valid"), body: "valid",
+			expected: http.StatusOK},
+		{name: "rotated secret with prefix", partner: "acme", timestamp: ts, signature: "sha256=" + sign("old-secret", ts, "old"),
+			body: "old", expected: http.StatusOK},
+		{name: "first delivery", partner: "acme", timestamp: ts, signature: replayed, body: "replayed", expected: http.StatusOK},
+		{name: "replay", partner: "acme", timestamp: ts, signature: replayed, body: "replayed", expected: http.StatusUnauthorized},
+		{name: "replay with uppercase signature", partner: "acme", timestamp: ts, signature: strings.ToUpper(replayed),
+			body: "replayed", expected: http.StatusUnauthorized},
+		{name: "tampered body", partner: "acme", timestamp: ts, signature: sign("new-secret", ts, "valid"), body: "other",
+			expected: http.StatusUnauthorized},
+		{name: "wrong secret", partner: "acme", timestamp: ts, signature: sign("guess", ts, "body"), body: "body",
+			expected: http.StatusUnauthorized},
+		{name: "unknown partner", partner: "other", timestamp: ts, signature: sign("new-secret", ts, "body"), body: "body",
+			expected: http.StatusUnauthorized},
+		{name: "stale timestamp", partner: "acme", timestamp: stale, signature: sign("new-secret", stale, "body"), body: "body",
+			expected: http.StatusUnauthorized},
+		{name: "missing signature", partner: "acme", timestamp: ts, body: "body", expected: http.StatusUnauthorized},
+		{name: "body too large", partner: "acme", timestamp: ts, signature: sign("new-secret", ts, strings.Repeat("x", 65)),
+			body: strings.Repeat("x", 65), expected: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(DefaultPartnerHeader, tt.partner)
+			req.Header.Set(DefaultTimestampHeader, tt.timestamp)
+			if tt.signature != "" {
+				req.Header.Set(DefaultSignatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.expected == http.StatusOK && w.Body.String() != "acme:"+tt.body {
+				t.Errorf("Expected handler to read the body, got %q", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/eminent85/go-app/internal/middleware"
+)
+
+// Policy is the access required by a route.
+type Policy struct {
+	Authenticated bool     `json:"authenticated"`
+	Scopes        []string `json:"scopes,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+}
+
+// merge adds the requirements of other to p.
+func (p *Policy) merge(other Policy) {
+	p.Authenticated = p.Authenticated || other.Authenticated
+	for _, s := range other.Scopes {
+		if !slices.Contains(p.Scopes, s) {
+			p.Scopes = append(p.Scopes, s)
+		}
+	}
+	for _, r := range other.Roles {
+		if !slices.Contains(p.Roles, r) {
+			p.Roles = append(p.Roles, r)
+		}
+	}
+}
+
+// guard is the handler installed by Require, RequireScopes and
+// RequireRoles. It carries its policy so Routes can report it.
+type guard struct {
+	policy Policy
+	http.Handler
+}
+
+// RequireScopes rejects requests whose principal lacks any of scopes with
+// 403. Requests without a principal get 401, so it must be used below
+// Require.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return authorize(Policy{Authenticated: true, Scopes: scopes}, "scope", (*Principal).HasScope)
+}
+
+// RequireRoles rejects requests whose principal lacks any of roles with
+// 403. Like RequireScopes, every role is required.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return authorize(Policy{Authenticated: true, Roles: roles}, "role", (*Principal).HasRole)
+}
+
+// authorize builds a guard requiring every value in the policy's scopes or
+// roles, checked with has.
+func authorize(policy Policy, kind string, has func(*Principal, string) bool) func(http.Handler) http.Handler {
+	required := slices.Concat(policy.Scopes, policy.Roles)
+	return func(next http.Handler) http.Handler {
+		return &guard{policy: policy, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				middleware.WriteProblem(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+
+			var missing []string
+			for _, v := range required {
+				if !has(p, v) {
+					missing = append(missing, v)
+				}
+			}
+			if len(missing) > 0 {
+				middleware.WriteProblem(w, http.StatusForbidden,
+					"Missing required "+kind+": "+strings.Join(missing, " "))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})}
+	}
+}
+
+// RoutePolicy is the access required by one route.
+type RoutePolicy struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Policy
+}
+
+// Routes lists every route in r with the access required by the guards in
+// its middleware chain, sorted by pattern and method.
+func Routes(r chi.Routes) ([]RoutePolicy, error) {
+	// Middlewares cannot be compared, so each is applied to a no-op
+	// handler to find the guards among them.
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	var routes []RoutePolicy
+	err := chi.Walk(r, func(method, pattern string, _ http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route := RoutePolicy{Method: method, Pattern: pattern}
+		for _, mw := range middlewares {
+			if g, ok := mw(noop).(*guard); ok {
+				route.merge(g.policy)
+			}
+		}
+		routes = append(routes, route)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(routes, func(a, b RoutePolicy) int {
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+	return routes, nil
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval limits refreshes, so tokens with made-up kids cannot
+// hammer the JWKS endpoint and an outage at the issuer is not met with a
+// fetch per request.
+const minRefreshInterval = time.Minute
+
+// maxJWKSSize caps JWKS and discovery documents.
+const maxJWKSSize = 1 << 20
+
+// jwk is a JSON Web Key as published in a JWKS.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey is a verification key with the algorithm it may be used with.
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// keySet fetches and caches the signing keys published at a JWKS URL. Keys
+// are refreshed every refreshInterval, and early when a token names a key
+// ID that is not cached, which picks up rotated keys. Fetches happen
+// outside mu and at most once per minRefreshInterval.
+type keySet struct {
+	url             string
+	issuer          string
+	refreshInterval time.Duration
+	client          *http.Client
+	now             func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]publicKey
+	fetched     time.Time
+	lastAttempt time.Time
+	lastErr     error
+	// refreshing is closed when the fetch in flight completes; nil when
+	// there is none.
+	refreshing chan struct{}
+}
+
+// key returns the verification key for kid. A cached key is returned
+// straight away, starting a background refresh when it is stale; a key
+// ID that is not cached waits for a refresh. Refreshes are attempted at
+// most once per minRefreshInterval, so a stale key keeps being used while
+// the JWKS endpoint is failing.
+func (s *keySet) key(ctx context.Context, kid string) (publicKey, error) {
+	s.mu.Lock()
+	now := s.now()
+	k, ok := s.keys[kid]
+	canRefresh := s.refreshing == nil && now.Sub(s.lastAttempt) >= minRefreshInterval
+	if ok {
+		if canRefresh && now.Sub(s.fetched) >= s.refreshInterval {
+			s.startRefresh(now)
+		}
+		s.mu.Unlock()
+		return k, nil
+	}
+
+	done := s.refreshing
+	if canRefresh {
+		done = s.startRefresh(now)
+	}
+	if done == nil {
+		err := s.lastErr
+		s.mu.Unlock()
+		if err != nil {
+			return publicKey{}, err
+		}
+		return publicKey{}, fmt.Errorf("unknown key ID %q", kid)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return publicKey{}, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok = s.keys[kid]; ok {
+		return k, nil
+	}
+	if s.lastErr != nil {
+		return publicKey{}, s.lastErr
+	}
+	return publicKey{}, fmt.Errorf("unknown key ID %q", kid)
+}
+
+// startRefresh fetches the keys in the background and returns a channel
+// closed when it completes. s.mu must be held.
+func (s *keySet) startRefresh(now time.Time) chan struct{} {
+	done := make(chan struct{})
+	s.refreshing = done
+	s.lastAttempt = now
+	url := s.url
+
+	go func() {
+		defer close(done)
+		// The fetch is shared by every waiting request, so it is bounded
+		// by the client's timeout rather than any one request's context.
+		url, keys, err := s.fetch(context.Background(), url)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.refreshing = nil
+		s.lastErr = err
+		if err != nil {
+			return
+		}
+		s.url = url
+		s.keys = keys
+		s.fetched = now
+	}()
+	return done
+}
+
+// fetch returns the keys published at url, discovering url from the
+// issuer when it is empty.
+func (s *keySet) fetch(ctx context.Context, url string) (string, map[string]publicKey, error) {
+	if url == "" {
+		var err error
+		if url, err = s.discover(ctx); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := s.getJSON(ctx, url, &set); err != nil {
+		return "", nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(j)
+		if err != nil {
+			// Skip keys we cannot use rather than rejecting the whole set
+			continue
+		}
+		keys[j.Kid] = k
+	}
+	return url, keys, nil
+}
+
+// discover resolves the JWKS URL from the issuer's OpenID Connect
+// discovery document.
+func (s *keySet) discover(ctx context.Context) (string, error) {
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	url := strings.TrimSuffix(s.issuer, "/") + "/.well-known/openid-configuration"
+	if err := s.getJSON(ctx, url, &doc); err != nil {
+		return "", fmt.Errorf("failed to discover JWKS: %w", err)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("failed to discover JWKS: no jwks_uri in discovery document")
+	}
+	return doc.JWKSURI, nil
+}
+
+func (s *keySet) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(v)
+}
+
+// parseJWK converts a JWK into a verification key for RS256, ES256 or
+// EdDSA.
+func parseJWK(j jwk) (publicKey, error) {
+	var k publicKey
+	switch {
+	case j.Kty == "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return k, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return k, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() {
+			return k, errors.New("unsupported RSA key")
+		}
+		k = publicKey{alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}}
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return k, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return k, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return k, errors.New("invalid P-256 key")
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return k, err
+		}
+		k = publicKey{alg: "ES256", key: pub}
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return k, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return k, errors.New("invalid Ed25519 key")
+		}
+		k = publicKey{alg: "EdDSA", key: ed25519.PublicKey(x)}
+	default:
+		return k, fmt.Errorf("unsupported key type %s %s", j.Kty, j.Crv)
+	}
+
+	if j.Alg != "" && j.Alg != k.alg {
+		return k, fmt.Errorf("unsupported algorithm %s", j.Alg)
+	}
+	return k, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MethodJWT is the Principal.Method for bearer token authentication.
+const MethodJWT = "jwt"
+
+// JWTOptions configures a JWTVerifier.
+type JWTOptions struct {
+	// JWKSURL publishes the signing keys. When empty it is discovered from
+	// the issuer's OpenID Connect configuration.
+	JWKSURL string
+	// Issuer and Audience must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// ClockSkew is tolerated when checking exp and nbf.
+	ClockSkew time.Duration
+	// RefreshInterval is how long fetched keys are cached.
+	RefreshInterval time.Duration
+	// HTTPClient fetches the JWKS. Defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+}
+
+// JWTVerifier authenticates requests carrying a bearer JWT signed with
+// RS256, ES256 or EdDSA by a key from the issuer's JWKS.
+type JWTVerifier struct {
+	opts JWTOptions
+	keys *keySet
+	now  func() time.Time
+}
+
+// NewJWTVerifier returns a verifier for opts. Keys are fetched on first use.
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	if opts.Issuer == "" || opts.Audience == "" {
+		return nil, errors.New("JWT verification requires an issuer and an audience")
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Hour
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWTVerifier{
+		opts: opts,
+		keys: &keySet{
+			url:             opts.JWKSURL,
+			issuer:          opts.Issuer,
+			refreshInterval: opts.RefreshInterval,
+			client:          opts.HTTPClient,
+			now:             time.Now,
+		},
+		now: time.Now,
+	}, nil
+}
+
+// Challenge implements Authenticator.
+func (v *JWTVerifier) Challenge() string {
+	return `Bearer realm="api"`
+}
+
+// Authenticate implements Authenticator using the Authorization header.
+func (v *JWTVerifier) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := v.verify(r, token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.principal(), nil
+}
+
+// jwtHeader is the JOSE header of a JWS.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// claims holds the registered claims checked by the verifier plus the full
+// claim set.
+type claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *numeric `json:"exp"`
+	NotBefore *numeric `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Scp       []string `json:"scp"`
+	Roles     []string `json:"roles"`
+	all       map[string]any
+}
+
+// verify checks the signature and claims of token.
+func (v *JWTVerifier) verify(r *http.Request, token string) (*claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidCredentials)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidCredentials)
+	}
+
+	key, err := v.keys.key(r.Context(), header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	// The key decides the algorithm; a token cannot downgrade it.
+	if header.Alg != key.alg || !verifySignature(key, parts[0]+"."+parts[1], sig) {
+		return nil, fmt.Errorf("%w: invalid signature", ErrInvalidCredentials)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidCredentials)
+	}
+	if err := decodeSegment(parts[1], &c.all); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidCredentials)
+	}
+	if err := v.validate(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// validate checks the registered claims.
+func (v *JWTVerifier) validate(c *claims) error {
+	now := v.now()
+	switch {
+	case c.Issuer != v.opts.Issuer:
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	case !slices.Contains(c.Audience, v.opts.Audience):
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	case c.ExpiresAt == nil:
+		return fmt.Errorf("%w: missing exp", ErrInvalidCredentials)
+	case !now.Before(c.ExpiresAt.Time().Add(v.opts.ClockSkew)):
+		return ErrExpiredCredentials
+	case c.NotBefore != nil && now.Add(v.opts.ClockSkew).Before(c.NotBefore.Time()):
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidCredentials)
+	}
+	return nil
+}
+
+// principal maps the claims to a Principal. Scopes come from the
+// space-separated scope claim or the scp array, and roles from the roles
+// array.
+func (c *claims) principal() *Principal {
+	scopes := c.Scp
+	if c.Scope != "" {
+		scopes = strings.Fields(c.Scope)
+	}
+	return &Principal{
+		Name:      c.Subject,
+		Method:    MethodJWT,
+		Scopes:    scopes,
+		Roles:     c.Roles,
+		ExpiresAt: c.ExpiresAt.Time(),
+		Claims:    c.all,
+	}
+}
+
+// verifySignature checks sig over signingInput with key.
+func verifySignature(key publicKey, signingInput string, sig []byte) bool {
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		sum := sha256.Sum256([]byte(signingInput))
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS encodes ECDSA signatures as r || s, not ASN.1
+		if len(sig) != 64 {
+			return false
+		}
+		sum := sha256.Sum256([]byte(signingInput))
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, sum[:], r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, []byte(signingInput), sig)
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audience is the aud claim, which may be a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// numeric is a NumericDate claim: seconds since the epoch, possibly
+// fractional.
+type numeric float64
+
+// Time returns the claim as a time.
+func (n *numeric) Time() time.Time {
+	if n == nil {
+		return time.Time{}
+	}
+	sec := float64(*n)
+	return time.Unix(int64(sec), int64((sec-float64(int64(sec)))*1e9))
+}
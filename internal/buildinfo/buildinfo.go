@@ -0,0 +1,87 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Info describes the running binary.
+type Info struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date"`
+	GoVersion string   `json:"go_version"`
+	Path      string   `json:"path,omitempty"`
+	Modules   []Module `json:"modules,omitempty"`
+}
+
+// Module describes a module dependency compiled into the binary.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// New combines the ldflags-injected values with the build information
+// embedded by the Go toolchain. VCS settings recorded by the toolchain fill
+// in the commit and date when they were not injected.
+func New(version, commit, date string) Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: date,
+		GoVersion: runtime.Version(),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	return fromBuildInfo(info, bi)
+}
+
+func fromBuildInfo(info Info, bi *debug.BuildInfo) Info {
+	info.Path = bi.Path
+	if bi.GoVersion != "" {
+		info.GoVersion = bi.GoVersion
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" || info.Commit == "unknown" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" || info.BuildDate == "unknown" {
+				info.BuildDate = s.Value
+			}
+		}
+	}
+
+	info.Modules = make([]Module, 0, len(bi.Deps))
+	for _, dep := range bi.Deps {
+		mod := Module{
+			Path:    dep.Path,
+			Version: dep.Version,
+			Sum:     dep.Sum,
+		}
+		if dep.Replace != nil {
+			mod.Replace = dep.Replace.Path + "@" + dep.Replace.Version
+		}
+		info.Modules = append(info.Modules, mod)
+	}
+
+	return info
+}
+
+// Labels returns the identifying fields as metric labels.
+func (i Info) Labels() map[string]string {
+	return map[string]string{
+		"version":   i.Version,
+		"commit":    i.Commit,
+		"date":      i.BuildDate,
+		"goversion": i.GoVersion,
+	}
+}
@@ -0,0 +1,78 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	info := New("1.0.0", "abc123", "2024-01-01T00:00:00Z")
+
+	if info.Version != "1.0.0" {
+		t.Errorf("Expected version 1.0.0, got %s", info.Version)
+	}
+
+	if info.Commit != "abc123" {
+		t.Errorf("Expected commit abc123, got %s", info.Commit)
+	}
+
+	if info.GoVersion == "" {
+		t.Error("Expected Go version to be set")
+	}
+}
+
+func TestFromBuildInfo(t *testing.T) {
+	bi := &debug.BuildInfo{
+		GoVersion: "go1.25.3",
+		Path:      "github.com/eminent85/go-app/cmd/server",
+		Deps: []*debug.Module{
+			{Path: "github.com/go-chi/chi/v5", Version: "v5.2.3", Sum: "h1:abc"},
+			{
+				Path:    "example.com/replaced",
+				Version: "v1.0.0",
+				Replace: &debug.Module{Path: "../local", Version: "v0.0.0"},
+			},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "deadbeef"},
+			{Key: "vcs.time", Value: "2024-01-01T00:00:00Z"},
+		},
+	}
+
+	info := fromBuildInfo(Info{Version: "dev", Commit: "unknown", GoVersion: runtime.Version()}, bi)
+
+	if info.Commit != "deadbeef" {
+		t.Errorf("Expected commit from vcs.revision, got %s", info.Commit)
+	}
+
+	if info.BuildDate != "2024-01-01T00:00:00Z" {
+		t.Errorf("Expected build date from vcs.time, got %s", info.BuildDate)
+	}
+
+	if info.GoVersion != "go1.25.3" {
+		t.Errorf("Expected go version go1.25.3, got %s", info.GoVersion)
+	}
+
+	if len(info.Modules) != 2 {
+		t.Fatalf("Expected 2 modules, got %d", len(info.Modules))
+	}
+
+	if info.Modules[1].Replace != "../local@v0.0.0" {
+		t.Errorf("Expected replace ../local@v0.0.0, got %s", info.Modules[1].Replace)
+	}
+
+	// Injected values take precedence over VCS settings.
+	info = fromBuildInfo(Info{Commit: "abc123", BuildDate: "today"}, bi)
+	if info.Commit != "abc123" || info.BuildDate != "today" {
+		t.Errorf("Expected injected values to be kept, got %s %s", info.Commit, info.BuildDate)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	labels := Info{Version: "1.0.0", Commit: "abc123", BuildDate: "today", GoVersion: "go1.25.3"}.Labels()
+
+	if labels["version"] != "1.0.0" || labels["commit"] != "abc123" || labels["goversion"] != "go1.25.3" {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+}
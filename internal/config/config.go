@@ -1,16 +1,30 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds all application configuration.
 type Config struct {
-	Server   ServerConfig
+	Server    ServerConfig
 	RateLimit RateLimitConfig
+	Events    EventsConfig
+	CORS      CORSConfig
+	WebSocket WebSocketConfig
+	Admin     AdminConfig
+	Debug     DebugConfig
+	Overload  OverloadConfig
+	Security  SecurityConfig
+	Auth      AuthConfig
+	Webhooks  WebhookConfig
 }
 
 // ServerConfig holds server-specific configuration.
@@ -22,6 +36,54 @@ type ServerConfig struct {
 	IdleTimeout     time.Duration
 	ShutdownTimeout time.Duration
 	Environment     string
+	ServiceID       string
+
+	// TLS settings. TLS is enabled when both TLSCertFile and TLSKeyFile are set.
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCAFile   string
+	TLSClientAuth     string
+	TLSMinVersion     string
+	TLSCipherPolicy   string
+	TLSReloadInterval time.Duration
+	// H2C enables HTTP/2 over plaintext connections with prior knowledge,
+	// for use behind proxies that terminate TLS.
+	H2C bool
+
+	// ListenAddress overrides Host and Port. It is "host:port" for TCP or
+	// "unix:///path/to.sock" for a Unix domain socket.
+	ListenAddress string
+	// SocketMode is the file mode applied to Unix sockets.
+	SocketMode os.FileMode
+	// ReusePort sets SO_REUSEPORT so a new binary can bind the same port
+	// while the old one drains.
+	ReusePort bool
+
+	// UpgradeEnabled hands the listeners to a new process on SIGUSR2 and
+	// drains this one once the new process is ready within UpgradeTimeout.
+	UpgradeEnabled bool
+	UpgradeTimeout time.Duration
+
+	// RequestTimeout is the context deadline for API requests, overridden
+	// per route pattern by RouteTimeouts. Zero means no deadline.
+	RequestTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+
+	// Slow-client protection. ReadHeaderTimeout and MaxHeaderBytes bound the
+	// request head; MaxBodyBytes caps bodies, overridden per route pattern by
+	// RouteBodyLimits; MinUploadRate in bytes per second is enforced once
+	// UploadRateGrace has passed.
+	ReadHeaderTimeout time.Duration
+	MaxHeaderBytes    int
+	MaxBodyBytes      int64
+	RouteBodyLimits   map[string]int64
+	MinUploadRate     int64
+	UploadRateGrace   time.Duration
+
+	// TrustedProxies are the networks of proxies whose RealIPHeader is
+	// believed when determining the client address. Empty trusts none.
+	TrustedProxies []netip.Prefix
+	RealIPHeader   string
 }
 
 // RateLimitConfig holds rate limiting configuration.
@@ -30,8 +92,155 @@ type RateLimitConfig struct {
 	Burst             int
 }
 
+// EventsConfig holds Server-Sent Events configuration.
+type EventsConfig struct {
+	BufferSize  int
+	HistorySize int
+	Heartbeat   time.Duration
+	Retry       time.Duration
+}
+
+// CORSConfig holds cross-origin configuration for the CORS middleware and
+// the WebSocket origin check.
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
+// defaultCORSOrigins allows every origin.
+var defaultCORSOrigins = []string{"https://*", "http://*"}
+
+// IsDefault reports whether the allowed origins are the permissive default.
+func (c *CORSConfig) IsDefault() bool {
+	return slices.Equal(c.AllowedOrigins, defaultCORSOrigins)
+}
+
+// WebSocketConfig holds WebSocket connection configuration.
+type WebSocketConfig struct {
+	MaxMessageSize int64
+	SendBufferSize int
+	PingInterval   time.Duration
+	PongTimeout    time.Duration
+	WriteTimeout   time.Duration
+}
+
+// AdminConfig holds configuration for the admin listener, which serves
+// health, metrics, profiling and configuration endpoints away from the
+// public port. It is disabled when Port is empty.
+type AdminConfig struct {
+	Port string
+	Host string
+	// WriteTimeout is longer than the public default so CPU profiles and
+	// traces can run to completion.
+	WriteTimeout time.Duration
+}
+
+// DebugConfig holds configuration for profiling and runtime debug endpoints.
+type DebugConfig struct {
+	// Enabled mounts the debug routes, on the admin listener when it is
+	// enabled and on the public listener otherwise.
+	Enabled bool
+	// Token is the bearer token required by every debug route.
+	Token string
+	// CaptureDir enables SIGUSR1-triggered profile captures into this
+	// directory.
+	CaptureDir      string
+	CaptureDuration time.Duration
+}
+
+// OverloadConfig holds concurrency limiting and load shedding configuration
+// for the API routes.
+type OverloadConfig struct {
+	// MaxConcurrent caps in-flight API requests. Zero disables the global cap.
+	MaxConcurrent int
+	// RouteLimits caps in-flight requests per route pattern.
+	RouteLimits map[string]int
+	// MaxQueue is how many requests may wait for a slot before being shed.
+	MaxQueue     int
+	QueueTimeout time.Duration
+	// RetryAfter is advertised to shed clients in the Retry-After header.
+	RetryAfter time.Duration
+
+	// AdaptiveEnabled adjusts the global cap between AdaptiveMinLimit and
+	// AdaptiveMaxLimit from request latency, starting at MaxConcurrent.
+	AdaptiveEnabled   bool
+	AdaptiveMinLimit  int
+	AdaptiveMaxLimit  int
+	AdaptiveWindow    time.Duration
+	AdaptiveTolerance float64
+	AdaptiveBackoff   float64
+}
+
+// Enabled reports whether any concurrency limit is configured.
+func (c *OverloadConfig) Enabled() bool {
+	return c.MaxConcurrent > 0 || len(c.RouteLimits) > 0
+}
+
+// SecurityConfig holds the security response headers. Defaults depend on
+// ENVIRONMENT: development omits HSTS and only reports CSP violations.
+type SecurityConfig struct {
+	HeadersEnabled        bool
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	// ContentSecurityPolicy may contain "{nonce}", replaced per request.
+	ContentSecurityPolicy string
+	CSPReportOnly         bool
+}
+
+// AuthConfig holds API authentication configuration. /api/v1 requires
+// authentication when any credentials are configured.
+type AuthConfig struct {
+	// APIKeysFile is a JSON file of hashed, named API keys, typically a
+	// mounted secret.
+	APIKeysFile string
+
+	// JWTIssuer enables bearer JWT authentication. Tokens must carry this
+	// issuer and JWTAudience, and be signed by a key from JWKSURL, which is
+	// discovered from the issuer when empty.
+	JWTIssuer           string
+	JWTAudience         string
+	JWKSURL             string
+	JWKSRefreshInterval time.Duration
+	JWTClockSkew        time.Duration
+}
+
+// JWTEnabled reports whether bearer JWT authentication is configured.
+func (c *AuthConfig) JWTEnabled() bool {
+	return c.JWTIssuer != ""
+}
+
+// WebhookConfig holds signed webhook verification configuration. /webhooks
+// is served only when a secrets file is configured.
+type WebhookConfig struct {
+	// SecretsFile is a JSON file of partners and their HMAC secrets,
+	// typically a mounted secret.
+	SecretsFile     string
+	SignatureHeader string
+	TimestampHeader string
+	PartnerHeader   string
+	// Tolerance is how far a signed timestamp may be from now.
+	Tolerance    time.Duration
+	MaxBodyBytes int64
+}
+
+// Enabled reports whether signed webhooks are accepted.
+func (c *WebhookConfig) Enabled() bool {
+	return c.SecretsFile != ""
+}
+
 // Load reads configuration from environment variables with sensible defaults.
 func Load() (*Config, error) {
+	environment := getEnv("ENVIRONMENT", "production")
+	development := environment == "development"
+
+	hstsMaxAge := 365 * 24 * time.Hour
+	if development {
+		hstsMaxAge = 0
+	}
+
 	config := &Config{
 		Server: ServerConfig{
 			Port:            getEnv("PORT", "8080"),
@@ -40,17 +249,299 @@ func Load() (*Config, error) {
 			WriteTimeout:    getEnvDuration("WRITE_TIMEOUT", 10*time.Second),
 			IdleTimeout:     getEnvDuration("IDLE_TIMEOUT", 120*time.Second),
 			ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
-			Environment:     getEnv("ENVIRONMENT", "production"),
+			Environment:     environment,
+			ServiceID:       getEnv("SERVICE_ID", "go-app"),
+
+			TLSCertFile:       getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:        getEnv("TLS_KEY_FILE", ""),
+			TLSClientCAFile:   getEnv("TLS_CLIENT_CA_FILE", ""),
+			TLSClientAuth:     getEnv("TLS_CLIENT_AUTH", ""),
+			TLSMinVersion:     getEnv("TLS_MIN_VERSION", "1.2"),
+			TLSCipherPolicy:   getEnv("TLS_CIPHER_POLICY", "intermediate"),
+			TLSReloadInterval: getEnvDuration("TLS_RELOAD_INTERVAL", time.Minute),
+			H2C:               getEnvBool("H2C_ENABLED", false),
+
+			ListenAddress: getEnv("LISTEN_ADDRESS", ""),
+			SocketMode:    getEnvFileMode("SOCKET_MODE", 0o660),
+			ReusePort:     getEnvBool("REUSE_PORT", false),
+
+			UpgradeEnabled: getEnvBool("UPGRADE_ENABLED", false),
+			UpgradeTimeout: getEnvDuration("UPGRADE_TIMEOUT", 30*time.Second),
+
+			RequestTimeout: getEnvDuration("REQUEST_TIMEOUT", 0),
+
+			ReadHeaderTimeout: getEnvDuration("READ_HEADER_TIMEOUT", 5*time.Second),
+			MaxHeaderBytes:    getEnvInt("MAX_HEADER_BYTES", 1<<20),
+			MaxBodyBytes:      int64(getEnvInt("MAX_BODY_BYTES", 1<<20)),
+			MinUploadRate:     int64(getEnvInt("MIN_UPLOAD_RATE", 240)),
+			UploadRateGrace:   getEnvDuration("UPLOAD_RATE_GRACE", 5*time.Second),
 		},
 		RateLimit: RateLimitConfig{
 			RequestsPerSecond: getEnvInt("RATE_LIMIT_RPS", 100),
 			Burst:             getEnvInt("RATE_LIMIT_BURST", 200),
 		},
+		Events: EventsConfig{
+			BufferSize:  getEnvInt("SSE_BUFFER_SIZE", 64),
+			HistorySize: getEnvInt("SSE_HISTORY_SIZE", 256),
+			Heartbeat:   getEnvDuration("SSE_HEARTBEAT", 15*time.Second),
+			Retry:       getEnvDuration("SSE_RETRY", 3*time.Second),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", slices.Clone(defaultCORSOrigins)),
+		},
+		WebSocket: WebSocketConfig{
+			MaxMessageSize: int64(getEnvInt("WS_MAX_MESSAGE_SIZE", 64*1024)),
+			SendBufferSize: getEnvInt("WS_SEND_BUFFER_SIZE", 32),
+			PingInterval:   getEnvDuration("WS_PING_INTERVAL", 30*time.Second),
+			PongTimeout:    getEnvDuration("WS_PONG_TIMEOUT", 60*time.Second),
+			WriteTimeout:   getEnvDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		},
+		Admin: AdminConfig{
+			Port:         getEnv("ADMIN_PORT", ""),
+			Host:         getEnv("ADMIN_HOST", "0.0.0.0"),
+			WriteTimeout: getEnvDuration("ADMIN_WRITE_TIMEOUT", 60*time.Second),
+		},
+		Debug: DebugConfig{
+			Enabled:         getEnvBool("DEBUG_ENABLED", false),
+			Token:           getEnv("DEBUG_TOKEN", ""),
+			CaptureDir:      getEnv("DEBUG_CAPTURE_DIR", ""),
+			CaptureDuration: getEnvDuration("DEBUG_CAPTURE_DURATION", 10*time.Second),
+		},
+		Overload: OverloadConfig{
+			MaxConcurrent: getEnvInt("MAX_CONCURRENT_REQUESTS", 0),
+			MaxQueue:      getEnvInt("MAX_QUEUED_REQUESTS", 100),
+			QueueTimeout:  getEnvDuration("QUEUE_TIMEOUT", time.Second),
+			RetryAfter:    getEnvDuration("RETRY_AFTER", time.Second),
+
+			AdaptiveEnabled:   getEnvBool("ADAPTIVE_CONCURRENCY", false),
+			AdaptiveMinLimit:  getEnvInt("ADAPTIVE_MIN_LIMIT", 10),
+			AdaptiveMaxLimit:  getEnvInt("ADAPTIVE_MAX_LIMIT", 1000),
+			AdaptiveWindow:    getEnvDuration("ADAPTIVE_WINDOW", time.Second),
+			AdaptiveTolerance: getEnvFloat("ADAPTIVE_LATENCY_TOLERANCE", 2),
+			AdaptiveBackoff:   getEnvFloat("ADAPTIVE_BACKOFF", 0.9),
+		},
+		Security: SecurityConfig{
+			HeadersEnabled:        getEnvBool("SECURITY_HEADERS", true),
+			HSTSMaxAge:            getEnvDuration("HSTS_MAX_AGE", hstsMaxAge),
+			HSTSIncludeSubdomains: getEnvBool("HSTS_INCLUDE_SUBDOMAINS", true),
+			HSTSPreload:           getEnvBool("HSTS_PRELOAD", false),
+			FrameOptions:          getEnv("FRAME_OPTIONS", "DENY"),
+			ReferrerPolicy:        getEnv("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+			PermissionsPolicy:     getEnv("PERMISSIONS_POLICY", "camera=(), microphone=(), geolocation=()"),
+			ContentSecurityPolicy: getEnv("CONTENT_SECURITY_POLICY", "default-src 'none'; frame-ancestors 'none'"),
+			CSPReportOnly:         getEnvBool("CSP_REPORT_ONLY", development),
+		},
+		Auth: AuthConfig{
+			APIKeysFile: getEnv("API_KEYS_FILE", ""),
+
+			JWTIssuer:           getEnv("JWT_ISSUER", ""),
+			JWTAudience:         getEnv("JWT_AUDIENCE", ""),
+			JWKSURL:             getEnv("JWT_JWKS_URL", ""),
+			JWKSRefreshInterval: getEnvDuration("JWT_JWKS_REFRESH_INTERVAL", time.Hour),
+			JWTClockSkew:        getEnvDuration("JWT_CLOCK_SKEW", time.Minute),
+		},
+		Webhooks: WebhookConfig{
+			SecretsFile:     getEnv("WEBHOOK_SECRETS_FILE", ""),
+			SignatureHeader: getEnv("WEBHOOK_SIGNATURE_HEADER", "X-Signature"),
+			TimestampHeader: getEnv("WEBHOOK_TIMESTAMP_HEADER", "X-Signature-Timestamp"),
+			PartnerHeader:   getEnv("WEBHOOK_PARTNER_HEADER", "X-Partner-ID"),
+			Tolerance:       getEnvDuration("WEBHOOK_TOLERANCE", 5*time.Minute),
+			MaxBodyBytes:    int64(getEnvInt("WEBHOOK_MAX_BODY_BYTES", 1<<20)),
+		},
+	}
+
+	routeLimits, err := parseRouteLimits(os.Getenv("ROUTE_CONCURRENCY_LIMITS"))
+	if err != nil {
+		return nil, err
+	}
+	config.Overload.RouteLimits = routeLimits
+
+	routeTimeouts, err := parseRouteTimeouts(os.Getenv("ROUTE_TIMEOUTS"))
+	if err != nil {
+		return nil, err
+	}
+	config.Server.RouteTimeouts = routeTimeouts
+
+	routeBodyLimits, err := parseRouteBodyLimits(os.Getenv("ROUTE_BODY_LIMITS"))
+	if err != nil {
+		return nil, err
+	}
+	config.Server.RouteBodyLimits = routeBodyLimits
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, err
+	}
+	config.Server.TrustedProxies = trustedProxies
+
+	realIPHeader, err := parseRealIPHeader(getEnv("REAL_IP_HEADER", "X-Forwarded-For"))
+	if err != nil {
+		return nil, err
+	}
+	config.Server.RealIPHeader = realIPHeader
+
+	if err := config.validate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
 
+// validate checks for inconsistent settings.
+func (c *Config) validate() error {
+	if err := c.Server.validateTLS(); err != nil {
+		return err
+	}
+	if err := c.Server.validateTimeouts(); err != nil {
+		return err
+	}
+	if c.Server.MaxBodyBytes < 0 || c.Server.MinUploadRate < 0 {
+		return errors.New("MAX_BODY_BYTES and MIN_UPLOAD_RATE must not be negative")
+	}
+	if err := c.validateAdmin(); err != nil {
+		return err
+	}
+	if c.Debug.Enabled && c.Debug.Token == "" {
+		return errors.New("DEBUG_ENABLED requires DEBUG_TOKEN")
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	if err := c.Webhooks.validate(); err != nil {
+		return err
+	}
+	return c.Overload.validate()
+}
+
+// validateAdmin checks that the admin listener does not clash with the
+// public one. Ports are compared as numbers, and an unspecified host
+// overlaps every other host.
+func (c *Config) validateAdmin() error {
+	if !c.Admin.Enabled() {
+		return nil
+	}
+	adminPort, err := net.LookupPort("tcp", c.Admin.Port)
+	if err != nil {
+		return fmt.Errorf("invalid ADMIN_PORT %q", c.Admin.Port)
+	}
+
+	host, port := c.Server.Host, c.Server.Port
+	if addr := c.Server.ListenAddress; addr != "" {
+		if strings.HasPrefix(addr, "unix://") {
+			return nil
+		}
+		if host, port, err = net.SplitHostPort(addr); err != nil {
+			return nil
+		}
+	}
+	publicPort, err := net.LookupPort("tcp", port)
+	if err != nil || publicPort != adminPort || !hostsOverlap(host, c.Admin.Host) {
+		return nil
+	}
+	return fmt.Errorf("admin listener %s clashes with public listener %s", c.Admin.Address(), c.Server.Address())
+}
+
+// hostsOverlap reports whether listeners on hosts a and b would share
+// addresses.
+func hostsOverlap(a, b string) bool {
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	if a == "" || b == "" || (errA == nil && ipA.IsUnspecified()) || (errB == nil && ipB.IsUnspecified()) {
+		return true
+	}
+	if errA == nil && errB == nil {
+		return ipA.Unmap() == ipB.Unmap()
+	}
+	return strings.EqualFold(a, b)
+}
+
+// validate checks that JWT settings are complete.
+func (c *AuthConfig) validate() error {
+	if (c.JWKSURL != "" || c.JWTAudience != "") && !c.JWTEnabled() {
+		return errors.New("JWT_JWKS_URL and JWT_AUDIENCE require JWT_ISSUER")
+	}
+	if c.JWTEnabled() && c.JWTAudience == "" {
+		return errors.New("JWT_ISSUER requires JWT_AUDIENCE")
+	}
+	return nil
+}
+
+// validate checks the webhook verification limits.
+func (c *WebhookConfig) validate() error {
+	if c.Enabled() && (c.Tolerance <= 0 || c.MaxBodyBytes <= 0) {
+		return errors.New("WEBHOOK_TOLERANCE and WEBHOOK_MAX_BODY_BYTES must be positive")
+	}
+	return nil
+}
+
+// validate checks the concurrency limit settings.
+func (c *OverloadConfig) validate() error {
+	if c.MaxConcurrent < 0 || c.MaxQueue < 0 {
+		return errors.New("MAX_CONCURRENT_REQUESTS and MAX_QUEUED_REQUESTS must not be negative")
+	}
+	if c.AdaptiveEnabled {
+		return c.validateAdaptive()
+	}
+	return nil
+}
+
+// validateTLS checks that the certificate settings are complete.
+func (c *ServerConfig) validateTLS() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSClientCAFile != "" && !c.TLSEnabled() {
+		return errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if c.TLSEnabled() && c.TLSReloadInterval <= 0 {
+		return errors.New("TLS_RELOAD_INTERVAL must be positive")
+	}
+	return nil
+}
+
+// validateTimeouts checks that request deadlines expire before the server
+// cuts the connection, so the timeout response can still be written.
+func (c *ServerConfig) validateTimeouts() error {
+	if c.RequestTimeout < 0 {
+		return errors.New("REQUEST_TIMEOUT must not be negative")
+	}
+	if c.UpgradeEnabled && c.UpgradeTimeout <= 0 {
+		return errors.New("UPGRADE_TIMEOUT must be positive")
+	}
+	if c.WriteTimeout <= 0 {
+		return nil
+	}
+	if c.RequestTimeout >= c.WriteTimeout {
+		return errors.New("REQUEST_TIMEOUT must be shorter than WRITE_TIMEOUT")
+	}
+	for pattern, timeout := range c.RouteTimeouts {
+		if timeout >= c.WriteTimeout {
+			return fmt.Errorf("ROUTE_TIMEOUTS entry for %s must be shorter than WRITE_TIMEOUT", pattern)
+		}
+	}
+	return nil
+}
+
+// validateAdaptive checks the adaptive concurrency settings.
+func (c *OverloadConfig) validateAdaptive() error {
+	if c.AdaptiveMinLimit < 1 || c.AdaptiveMinLimit > c.AdaptiveMaxLimit {
+		return errors.New("ADAPTIVE_MIN_LIMIT must be at least 1 and not above ADAPTIVE_MAX_LIMIT")
+	}
+	if c.MaxConcurrent < c.AdaptiveMinLimit || c.MaxConcurrent > c.AdaptiveMaxLimit {
+		return errors.New("ADAPTIVE_CONCURRENCY requires MAX_CONCURRENT_REQUESTS between ADAPTIVE_MIN_LIMIT and ADAPTIVE_MAX_LIMIT")
+	}
+	if c.AdaptiveWindow <= 0 {
+		return errors.New("ADAPTIVE_WINDOW must be positive")
+	}
+	if c.AdaptiveTolerance <= 1 {
+		return errors.New("ADAPTIVE_LATENCY_TOLERANCE must be greater than 1")
+	}
+	if c.AdaptiveBackoff <= 0 || c.AdaptiveBackoff >= 1 {
+		return errors.New("ADAPTIVE_BACKOFF must be between 0 and 1")
+	}
+	return nil
+}
+
 // getEnv retrieves an environment variable or returns a default value.
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -69,6 +560,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvFloat retrieves a floating-point environment variable or returns a default value.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
 // getEnvDuration retrieves a duration environment variable or returns a default value.
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
@@ -79,7 +580,151 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getEnvBool retrieves a boolean environment variable or returns a default value.
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFileMode retrieves an octal file mode environment variable or returns a default value.
+func getEnvFileMode(key string, defaultValue os.FileMode) os.FileMode {
+	if value := os.Getenv(key); value != "" {
+		if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+			return os.FileMode(mode) & os.ModePerm
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList retrieves a comma-separated environment variable or returns a default value.
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return defaultValue
+	}
+	return list
+}
+
+// parseRouteLimits parses "pattern=limit" pairs separated by commas, such as
+// "/api/v1/events=50,/api/v1/ws=200".
+func parseRouteLimits(value string) (map[string]int, error) {
+	return parseRoutes("ROUTE_CONCURRENCY_LIMITS", value, func(v string) (int, bool) {
+		limit, err := strconv.Atoi(v)
+		return limit, err == nil && limit > 0
+	})
+}
+
+// parseRouteTimeouts parses "pattern=duration" pairs separated by commas,
+// such as "/api/v1/hello=2s,/api/v1/reports=30s". A zero duration disables
+// the deadline for that route.
+func parseRouteTimeouts(value string) (map[string]time.Duration, error) {
+	return parseRoutes("ROUTE_TIMEOUTS", value, func(v string) (time.Duration, bool) {
+		timeout, err := time.ParseDuration(v)
+		return timeout, err == nil && timeout >= 0
+	})
+}
+
+// parseRouteBodyLimits parses "pattern=bytes" pairs separated by commas, such
+// as "/api/v1/uploads=104857600". Zero removes the cap for that route.
+func parseRouteBodyLimits(value string) (map[string]int64, error) {
+	return parseRoutes("ROUTE_BODY_LIMITS", value, func(v string) (int64, bool) {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		return limit, err == nil && limit >= 0
+	})
+}
+
+// parseRoutes parses comma-separated "pattern=value" pairs from the
+// environment variable key. The value follows the last "=" so patterns may
+// contain one.
+func parseRoutes[T any](key, value string, parse func(string) (T, bool)) (map[string]T, error) {
+	routes := make(map[string]T)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid %s entry %q: expected pattern=value", key, item)
+		}
+		v, ok := parse(strings.TrimSpace(item[i+1:]))
+		if !ok {
+			return nil, fmt.Errorf("invalid %s entry %q", key, item)
+		}
+		routes[strings.TrimSpace(item[:i])] = v
+	}
+	return routes, nil
+}
+
+// parseTrustedProxies parses a comma-separated list of CIDR prefixes or
+// single addresses.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: expected an IP address or CIDR", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// realIPHeaders are the headers the client address may be read from.
+var realIPHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+// parseRealIPHeader returns the canonical spelling of a client address
+// header.
+func parseRealIPHeader(value string) (string, error) {
+	for _, header := range realIPHeaders {
+		if strings.EqualFold(value, header) {
+			return header, nil
+		}
+	}
+	return "", fmt.Errorf("REAL_IP_HEADER must be one of %s, got %q", strings.Join(realIPHeaders, ", "), value)
+}
+
 // Address returns the full server address.
 func (c *ServerConfig) Address() string {
+	if c.ListenAddress != "" {
+		return c.ListenAddress
+	}
+	return fmt.Sprintf("%s:%s", c.Host, c.Port)
+}
+
+// TLSEnabled reports whether the server should serve HTTPS.
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Enabled reports whether the admin listener should be started.
+func (c *AdminConfig) Enabled() bool {
+	return c.Port != ""
+}
+
+// Address returns the full admin server address.
+func (c *AdminConfig) Address() string {
 	return fmt.Sprintf("%s:%s", c.Host, c.Port)
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,6 +21,10 @@ func TestLoad(t *testing.T) {
 	if cfg.Server.Host != "0.0.0.0" {
 		t.Errorf("Expected default host 0.0.0.0, got %s", cfg.Server.Host)
 	}
+
+	if !cfg.CORS.IsDefault() {
+		t.Errorf("Expected default CORS origins, got %v", cfg.CORS.AllowedOrigins)
+	}
 }
 
 func TestLoadWithEnvVars(t *testing.T) {
@@ -61,6 +66,11 @@ func TestServerConfigAddress(t *testing.T) {
 	if addr := cfg.Address(); addr != expected {
 		t.Errorf("Expected address %s, got %s", expected, addr)
 	}
+
+	cfg.ListenAddress = "unix:///run/go-app.sock"
+	if addr := cfg.Address(); addr != cfg.ListenAddress {
+		t.Errorf("Expected address %s, got %s", cfg.ListenAddress, addr)
+	}
 }
 
 func TestGetEnvInt(t *testing.T) {
@@ -118,3 +128,563 @@ func TestGetEnvDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEnvFloat(t *testing.T) {
+	tests := []struct {
+		name         string
+		envKey       string
+		envValue     string
+		defaultValue float64
+		expected     float64
+	}{
+		{"valid float", "TEST_FLOAT", "1.5", 2, 1.5},
+		{"invalid float", "TEST_FLOAT", "invalid", 2, 2},
+		{"missing env", "MISSING_KEY", "", 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envValue != "" {
+				os.Setenv(tt.envKey, tt.envValue)
+				defer os.Unsetenv(tt.envKey)
+			}
+
+			result := getEnvFloat(tt.envKey, tt.defaultValue)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetEnvFileMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		expected os.FileMode
+	}{
+		{"octal", "0600", 0o600},
+		{"without leading zero", "660", 0o660},
+		{"invalid", "rw-rw----", 0o640},
+		{"non-octal digits", "0999", 0o640},
+		{"missing env", "", 0o640},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envValue != "" {
+				os.Setenv("TEST_MODE", tt.envValue)
+				defer os.Unsetenv("TEST_MODE")
+			}
+
+			if result := getEnvFileMode("TEST_MODE", 0o640); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetEnvList(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue []string
+		expected     []string
+	}{
+		{"comma separated", "a, b ,c", []string{"x"}, []string{"a", "b", "c"}},
+		{"only separators", " , ", []string{"x"}, []string{"x"}},
+		{"missing env", "", []string{"x"}, []string{"x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envValue != "" {
+				os.Setenv("TEST_LIST", tt.envValue)
+				defer os.Unsetenv("TEST_LIST")
+			}
+
+			result := getEnvList("TEST_LIST", tt.defaultValue)
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetEnvBool(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue bool
+		expected     bool
+	}{
+		{"true", "true", false, true},
+		{"numeric false", "0", true, false},
+		{"invalid bool", "maybe", true, true},
+		{"missing env", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envValue != "" {
+				os.Setenv("TEST_BOOL", tt.envValue)
+				defer os.Unsetenv("TEST_BOOL")
+			}
+
+			if result := getEnvBool("TEST_BOOL", tt.defaultValue); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestLoadTLSValidation(t *testing.T) {
+	os.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	defer os.Unsetenv("TLS_CERT_FILE")
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when only TLS_CERT_FILE is set")
+	}
+
+	os.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	defer os.Unsetenv("TLS_KEY_FILE")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Server.TLSEnabled() {
+		t.Error("Expected TLS to be enabled")
+	}
+
+	os.Setenv("TLS_RELOAD_INTERVAL", "0s")
+	defer os.Unsetenv("TLS_RELOAD_INTERVAL")
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a zero TLS_RELOAD_INTERVAL")
+	}
+}
+
+func TestLoadAdmin(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Admin.Enabled() {
+		t.Error("Expected admin listener to be disabled by default")
+	}
+
+	os.Setenv("ADMIN_PORT", "9090")
+	defer os.Unsetenv("ADMIN_PORT")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Admin.Enabled() {
+		t.Error("Expected admin listener to be enabled")
+	}
+	if addr := cfg.Admin.Address(); addr != "0.0.0.0:9090" {
+		t.Errorf("Expected address 0.0.0.0:9090, got %s", addr)
+	}
+
+	os.Setenv("ADMIN_PORT", "8080")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when ADMIN_PORT equals PORT")
+	}
+}
+
+func TestValidateAdminAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		port      string
+		listen    string
+		adminHost string
+		adminPort string
+		wantErr   bool
+	}{
+		{name: "different ports", host: "0.0.0.0", port: "8080", adminHost: "0.0.0.0", adminPort: "9090"},
+		{name: "same port", host: "0.0.0.0", port: "8080", adminHost: "0.0.0.0", adminPort: "8080", wantErr: true},
+		{name: "leading zero", host: "0.0.0.0", port: "8080", adminHost: "0.0.0.0", adminPort: "08080", wantErr: true},
+		{name: "wildcard and loopback", host: "0.0.0.0", port: "8080", adminHost: "127.0.0.1", adminPort: "8080", wantErr: true},
+		{name: "same host", host: "127.0.0.1", port: "8080", adminHost: "127.0.0.1", adminPort: "8080", wantErr: true},
+		{name: "different hosts", host: "10.0.0.1", port: "8080", adminHost: "127.0.0.1", adminPort: "8080"},
+		{name: "listen address", listen: "127.0.0.1:9090", adminHost: "0.0.0.0", adminPort: "9090", wantErr: true},
+		{name: "unix socket", listen: "unix:///run/app.sock", adminHost: "0.0.0.0", adminPort: "8080"},
+		{name: "invalid admin port", host: "0.0.0.0", port: "8080", adminHost: "0.0.0.0", adminPort: "nope", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{Host: tt.host, Port: tt.port, ListenAddress: tt.listen},
+				Admin:  AdminConfig{Host: tt.adminHost, Port: tt.adminPort},
+			}
+			err := cfg.validateAdmin()
+			if tt.wantErr && err == nil {
+				t.Error("Expected validation error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadDebugValidation(t *testing.T) {
+	os.Setenv("DEBUG_ENABLED", "true")
+	defer os.Unsetenv("DEBUG_ENABLED")
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when DEBUG_ENABLED is set without DEBUG_TOKEN")
+	}
+
+	os.Setenv("DEBUG_TOKEN", "secret")
+	defer os.Unsetenv("DEBUG_TOKEN")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Debug.Enabled || cfg.Debug.Token != "secret" {
+		t.Errorf("Unexpected debug config: %+v", cfg.Debug)
+	}
+}
+
+func TestParseRouteLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected map[string]int
+		wantErr  bool
+	}{
+		{name: "empty", value: "", expected: map[string]int{}},
+		{
+			name:     "multiple routes",
+			value:    "/api/v1/events=50, /api/v1/ws=200",
+			expected: map[string]int{"/api/v1/events": 50, "/api/v1/ws": 200},
+		},
+		{name: "missing limit", value: "/api/v1/events", wantErr: true},
+		{name: "invalid limit", value: "/api/v1/events=many", wantErr: true},
+		{name: "zero limit", value: "/api/v1/events=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits, err := parseRouteLimits(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(limits) != len(tt.expected) {
+				t.Fatalf("Expected %d limits, got %d", len(tt.expected), len(limits))
+			}
+			for pattern, limit := range tt.expected {
+				if limits[pattern] != limit {
+					t.Errorf("Expected limit %d for %s, got %d", limit, pattern, limits[pattern])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadOverload(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Overload.Enabled() {
+		t.Error("Expected concurrency limits to be disabled by default")
+	}
+
+	os.Setenv("ROUTE_CONCURRENCY_LIMITS", "/api/v1/events")
+	defer os.Unsetenv("ROUTE_CONCURRENCY_LIMITS")
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for invalid ROUTE_CONCURRENCY_LIMITS")
+	}
+
+	os.Setenv("ROUTE_CONCURRENCY_LIMITS", "/api/v1/events=10")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Overload.Enabled() || cfg.Overload.RouteLimits["/api/v1/events"] != 10 {
+		t.Errorf("Unexpected overload config: %+v", cfg.Overload)
+	}
+}
+
+func TestLoadAdaptiveValidation(t *testing.T) {
+	os.Setenv("ADAPTIVE_CONCURRENCY", "true")
+	defer os.Unsetenv("ADAPTIVE_CONCURRENCY")
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when ADAPTIVE_CONCURRENCY is set without MAX_CONCURRENT_REQUESTS")
+	}
+
+	os.Setenv("MAX_CONCURRENT_REQUESTS", "100")
+	defer os.Unsetenv("MAX_CONCURRENT_REQUESTS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Overload.AdaptiveMinLimit != 10 || cfg.Overload.AdaptiveMaxLimit != 1000 {
+		t.Errorf("Unexpected adaptive limits: %+v", cfg.Overload)
+	}
+
+	os.Setenv("ADAPTIVE_BACKOFF", "1.5")
+	defer os.Unsetenv("ADAPTIVE_BACKOFF")
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for ADAPTIVE_BACKOFF above 1")
+	}
+}
+
+func TestLoadRequestTimeouts(t *testing.T) {
+	os.Setenv("ROUTE_TIMEOUTS", "/api/v1/hello=2s,/api/v1/reports=0")
+	defer os.Unsetenv("ROUTE_TIMEOUTS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Server.RequestTimeout != 0 {
+		t.Errorf("Expected no default request timeout, got %v", cfg.Server.RequestTimeout)
+	}
+	if got := cfg.Server.RouteTimeouts["/api/v1/hello"]; got != 2*time.Second {
+		t.Errorf("Expected 2s for /api/v1/hello, got %v", got)
+	}
+	if got, ok := cfg.Server.RouteTimeouts["/api/v1/reports"]; !ok || got != 0 {
+		t.Errorf("Expected disabled timeout for /api/v1/reports, got %v", got)
+	}
+}
+
+func TestLoadRequestTimeoutValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"invalid duration", "ROUTE_TIMEOUTS", "/api/v1/hello=soon"},
+		{"route timeout above write timeout", "ROUTE_TIMEOUTS", "/api/v1/hello=1m"},
+		{"default above write timeout", "REQUEST_TIMEOUT", "10s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(tt.key, tt.value)
+			defer os.Unsetenv(tt.key)
+
+			if _, err := Load(); err == nil {
+				t.Errorf("Expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadUpgradeValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "disabled", env: map[string]string{"UPGRADE_TIMEOUT": "0s"}},
+		{name: "enabled", env: map[string]string{"UPGRADE_ENABLED": "true"}},
+		{name: "zero timeout", env: map[string]string{"UPGRADE_ENABLED": "true", "UPGRADE_TIMEOUT": "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			if _, err := Load(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadBodyLimits(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Server.MaxBodyBytes != 1<<20 || cfg.Server.MaxHeaderBytes != 1<<20 {
+		t.Errorf("Unexpected default limits: body %d, header %d", cfg.Server.MaxBodyBytes, cfg.Server.MaxHeaderBytes)
+	}
+	if cfg.Server.ReadHeaderTimeout != 5*time.Second {
+		t.Errorf("Expected ReadHeaderTimeout 5s, got %v", cfg.Server.ReadHeaderTimeout)
+	}
+
+	os.Setenv("ROUTE_BODY_LIMITS", "/api/v1/uploads=104857600,/api/v1/stream=0")
+	defer os.Unsetenv("ROUTE_BODY_LIMITS")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got := cfg.Server.RouteBodyLimits["/api/v1/uploads"]; got != 104857600 {
+		t.Errorf("Expected limit 104857600, got %d", got)
+	}
+
+	os.Setenv("ROUTE_BODY_LIMITS", "/api/v1/uploads=-1")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for negative ROUTE_BODY_LIMITS entry")
+	}
+}
+
+func TestLoadSecurityDefaults(t *testing.T) {
+	tests := []struct {
+		environment string
+		hsts        time.Duration
+		reportOnly  bool
+	}{
+		{"production", 365 * 24 * time.Hour, false},
+		{"development", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			os.Setenv("ENVIRONMENT", tt.environment)
+			defer os.Unsetenv("ENVIRONMENT")
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if !cfg.Security.HeadersEnabled {
+				t.Error("Expected security headers to be enabled")
+			}
+			if cfg.Security.HSTSMaxAge != tt.hsts {
+				t.Errorf("Expected HSTS max age %v, got %v", tt.hsts, cfg.Security.HSTSMaxAge)
+			}
+			if cfg.Security.CSPReportOnly != tt.reportOnly {
+				t.Errorf("Expected CSP report-only %v, got %v", tt.reportOnly, cfg.Security.CSPReportOnly)
+			}
+		})
+	}
+}
+
+func TestLoadJWTValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "disabled", env: map[string]string{}},
+		{name: "issuer and audience", env: map[string]string{"JWT_ISSUER": "https://issuer.example", "JWT_AUDIENCE": "go-app"}},
+		{name: "issuer without audience", env: map[string]string{"JWT_ISSUER": "https://issuer.example"}, wantErr: true},
+		{name: "JWKS without issuer", env: map[string]string{"JWT_JWKS_URL": "https://issuer.example/jwks"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && cfg.Auth.JWTEnabled() != (tt.env["JWT_ISSUER"] != "") {
+				t.Errorf("Unexpected JWT enabled state: %+v", cfg.Auth)
+			}
+		})
+	}
+}
+
+func TestLoadWebhookValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "disabled", env: map[string]string{"WEBHOOK_TOLERANCE": "0"}},
+		{name: "enabled", env: map[string]string{"WEBHOOK_SECRETS_FILE": "/etc/go-app/webhooks.json"}},
+		{name: "zero tolerance", env: map[string]string{"WEBHOOK_SECRETS_FILE": "/etc/go-app/webhooks.json", "WEBHOOK_TOLERANCE": "0"},
+			wantErr: true},
+		{name: "zero body cap", env: map[string]string{"WEBHOOK_SECRETS_FILE": "/etc/go-app/webhooks.json", "WEBHOOK_MAX_BODY_BYTES": "0"},
+			wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && cfg.Webhooks.Enabled() != (tt.env["WEBHOOK_SECRETS_FILE"] != "") {
+				t.Errorf("Unexpected webhooks enabled state: %+v", cfg.Webhooks)
+			}
+		})
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name     string
+		proxies  string
+		header   string
+		expected string
+		wantErr  bool
+	}{
+		{name: "defaults", expected: ""},
+		{name: "prefixes and addresses", proxies: "10.0.0.0/8, 192.168.1.7,2001:db8::1/32", header: "forwarded",
+			expected: "10.0.0.0/8 192.168.1.7/32 2001:db8::/32"},
+		{name: "invalid proxy", proxies: "10.0.0.0/33", wantErr: true},
+		{name: "invalid header", header: "True-Client-IP", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.proxies != "" {
+				os.Setenv("TRUSTED_PROXIES", tt.proxies)
+				defer os.Unsetenv("TRUSTED_PROXIES")
+			}
+			if tt.header != "" {
+				os.Setenv("REAL_IP_HEADER", tt.header)
+				defer os.Unsetenv("REAL_IP_HEADER")
+			}
+
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			var proxies []string
+			for _, p := range cfg.Server.TrustedProxies {
+				proxies = append(proxies, p.String())
+			}
+			if got := strings.Join(proxies, " "); got != tt.expected {
+				t.Errorf("Expected trusted proxies %q, got %q", tt.expected, got)
+			}
+			expectedHeader := "X-Forwarded-For"
+			if tt.header != "" {
+				expectedHeader = "Forwarded"
+			}
+			if cfg.Server.RealIPHeader != expectedHeader {
+				t.Errorf("Expected header %s, got %s", expectedHeader, cfg.Server.RealIPHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// Capture writes a heap profile, a goroutine dump, a CPU profile and an
+// execution trace into a new timestamped subdirectory of dir and returns the
+// written paths. The CPU profile and trace are recorded concurrently for
+// duration.
+func Capture(dir string, duration time.Duration) ([]string, error) {
+	out := filepath.Join(dir, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(out, 0o750); err != nil {
+		return nil, fmt.Errorf("creating capture directory: %w", err)
+	}
+
+	write := func(name string, fn func(w io.Writer) error) (string, error) {
+		path := filepath.Join(out, name)
+		f, err := os.Create(path) //nolint:gosec // path is built from configuration
+		if err != nil {
+			return "", err
+		}
+		if err := fn(f); err != nil {
+			f.Close()
+			return "", fmt.Errorf("writing %s: %w", name, err)
+		}
+		return path, f.Close()
+	}
+
+	var paths []string
+	snapshots := []struct {
+		file, profile string
+		debug         int
+	}{
+		{"heap.pprof", "heap", 0},
+		{"goroutines.txt", "goroutine", 2},
+	}
+	for _, snap := range snapshots {
+		path, err := write(snap.file, func(w io.Writer) error {
+			return pprof.Lookup(snap.profile).WriteTo(w, snap.debug)
+		})
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	record := func(name string, start func(w io.Writer) error, stop func()) {
+		defer wg.Done()
+		path, err := write(name, func(w io.Writer) error {
+			if err := start(w); err != nil {
+				return err
+			}
+			time.Sleep(duration)
+			stop()
+			return nil
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		paths = append(paths, path)
+	}
+	wg.Add(2)
+	go record("cpu.pprof", pprof.StartCPUProfile, pprof.StopCPUProfile)
+	go record("trace.out", trace.Start, trace.Stop)
+	wg.Wait()
+
+	return paths, errors.Join(errs...)
+}
+
+// captureOnSignal runs Capture every time a value arrives on sig, until ctx
+// is canceled, reporting to logger. Captures never overlap: signals received
+// while one is in progress are dropped.
+func captureOnSignal(ctx context.Context, sig <-chan os.Signal, dir string, duration time.Duration, logger *log.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			logger.Printf("debug: capturing profiles to %s for %s", dir, duration)
+			paths, err := Capture(dir, duration)
+			if err != nil {
+				logger.Printf("debug: capture failed: %v", err)
+			}
+			for _, p := range paths {
+				logger.Printf("debug: wrote %s", p)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package debug
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Handler returns the debug route group: the net/http/pprof endpoints
+// (including execution traces at /pprof/trace), a full goroutine dump and a
+// GC trigger. Every request must carry token as a bearer token. Mount it at
+// /debug so the pprof index links resolve. Profiles and traces extend their
+// write deadline by the requested duration through http.ResponseController,
+// so every writer wrapping them must implement Unwrap.
+func Handler(token string) http.Handler {
+	r := chi.NewRouter()
+	r.Use(RequireToken(token))
+
+	r.HandleFunc("/pprof/*", pprof.Index)
+	r.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/pprof/profile", pprof.Profile)
+	r.HandleFunc("/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/pprof/trace", pprof.Trace)
+
+	r.Get("/goroutines", GoroutinesHandler)
+	r.Post("/gc", GCHandler)
+
+	return r
+}
+
+// RequireToken rejects requests without the expected bearer token. An empty
+// token rejects everything, so a misconfigured deployment fails closed.
+func RequireToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GoroutinesHandler writes the stacks of all goroutines in the same format
+// as an unrecovered panic.
+func GoroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// GCHandler forces a garbage collection and reports the heap size after it.
+func GCHandler(w http.ResponseWriter, r *http.Request) {
+	runtime.GC()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	writeJSON(w, http.StatusOK, map[string]uint64{
+		"heap_alloc_bytes": stats.HeapAlloc,
+		"num_gc":           uint64(stats.NumGC),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
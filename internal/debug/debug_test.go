@@ -0,0 +1,143 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newDebugRouter(token string) http.Handler {
+	r := chi.NewRouter()
+	r.Mount("/debug", Handler(token))
+	return r
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		expected      int
+	}{
+		{"missing", "secret", "", http.StatusUnauthorized},
+		{"wrong", "secret", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"empty configured token", "", "Bearer ", http.StatusUnauthorized},
+		{"valid", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", http.NoBody)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			newDebugRouter(tt.token).ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status code %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlerRoutes(t *testing.T) {
+	h := newDebugRouter("secret")
+
+	tests := []struct {
+		method   string
+		path     string
+		contains string
+	}{
+		{http.MethodGet, "/debug/pprof/", "goroutine"},
+		{http.MethodGet, "/debug/pprof/heap?debug=1", "heap profile"},
+		{http.MethodGet, "/debug/goroutines", "goroutine"},
+		{http.MethodPost, "/debug/gc", "heap_alloc_bytes"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, http.NoBody)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s %s: expected status code %d, got %d", tt.method, tt.path, http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("%s %s: expected body to contain %q", tt.method, tt.path, tt.contains)
+		}
+	}
+}
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := Capture(dir, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]bool{"heap.pprof": false, "goroutines.txt": false, "cpu.pprof": false, "trace.out": false}
+	for _, p := range paths {
+		expected[filepath.Base(p)] = true
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", p, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("Expected %s to be non-empty", p)
+		}
+	}
+	for name, found := range expected {
+		if !found {
+			t.Errorf("Expected %s to be captured", name)
+		}
+	}
+}
+
+func TestCaptureOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	sig := make(chan os.Signal, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var logs bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		captureOnSignal(ctx, sig, dir, 10*time.Millisecond, log.New(&logs, "", 0))
+		close(done)
+	}()
+
+	sig <- os.Interrupt
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*", "trace.out"))
+		if len(matches) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*", "*")); len(matches) != 4 {
+		t.Errorf("Expected 4 captured files, got %d", len(matches))
+	}
+	if !strings.Contains(logs.String(), "debug: wrote ") {
+		t.Errorf("Expected captures to be logged to the given logger, got %q", logs.String())
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package debug
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WatchSignal is a no-op on platforms without SIGUSR1.
+func WatchSignal(ctx context.Context, dir string, duration time.Duration, logger *log.Logger) {
+	logger.Printf("debug: signal-triggered capture is not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package debug
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WatchSignal captures profiles into dir whenever the process receives
+// SIGUSR1, until ctx is canceled, reporting each capture to logger.
+func WatchSignal(ctx context.Context, dir string, duration time.Duration, logger *log.Logger) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	defer signal.Stop(sig)
+
+	captureOnSignal(ctx, sig, dir, duration, logger)
+}
@@ -0,0 +1,249 @@
+package events
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSlowConsumer ends a subscription whose buffer filled up.
+	ErrSlowConsumer = errors.New("subscriber too slow, buffer full")
+	// ErrBrokerClosed ends all subscriptions when the broker shuts down.
+	ErrBrokerClosed = errors.New("broker closed")
+)
+
+const (
+	// DefaultBufferSize is the per-subscription buffer when none is given.
+	DefaultBufferSize = 64
+	// DefaultHistorySize is the number of events kept for resumption when
+	// none is given.
+	DefaultHistorySize = 256
+)
+
+// Event is a message published on a topic.
+type Event struct {
+	ID    string    `json:"id"`
+	Topic string    `json:"topic"`
+	Data  []byte    `json:"data"`
+	Time  time.Time `json:"time"`
+
+	seq uint64
+}
+
+// Options configures a Broker.
+type Options struct {
+	// BufferSize is the number of undelivered events a subscription may
+	// hold before it is dropped as a slow consumer.
+	BufferSize int
+	// HistorySize is the number of recent events retained so reconnecting
+	// clients can resume after their last seen event ID.
+	HistorySize int
+	// Epoch prefixes event IDs so IDs handed out by an earlier process are
+	// not mistaken for current ones. Defaults to the broker's creation time.
+	Epoch string
+}
+
+// Broker fans published events out to subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	subs        map[*Subscription]struct{}
+	history     []Event
+	historySize int
+	bufferSize  int
+	epoch       string
+	seq         uint64
+	closed      bool
+}
+
+// NewBroker creates a Broker.
+func NewBroker(opts Options) *Broker {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.HistorySize < 0 {
+		opts.HistorySize = 0
+	} else if opts.HistorySize == 0 {
+		opts.HistorySize = DefaultHistorySize
+	}
+
+	if opts.Epoch == "" {
+		opts.Epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return &Broker{
+		subs:        make(map[*Subscription]struct{}),
+		history:     make([]Event, 0, opts.HistorySize),
+		historySize: opts.HistorySize,
+		bufferSize:  opts.BufferSize,
+		epoch:       opts.Epoch,
+	}
+}
+
+// Publish sends data to all subscribers of topic and returns the event.
+// Subscribers whose buffers are full are disconnected rather than blocking
+// the publisher.
+func (b *Broker) Publish(topic string, data []byte) (Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return Event{}, ErrBrokerClosed
+	}
+
+	b.seq++
+	ev := Event{
+		ID:    b.epoch + "-" + strconv.FormatUint(b.seq, 10),
+		Topic: topic,
+		Data:  data,
+		Time:  time.Now(),
+		seq:   b.seq,
+	}
+
+	if b.historySize > 0 {
+		if len(b.history) == b.historySize {
+			copy(b.history, b.history[1:])
+			b.history = b.history[:len(b.history)-1]
+		}
+		b.history = append(b.history, ev)
+	}
+
+	for sub := range b.subs {
+		if !sub.matches(topic) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			b.removeLocked(sub, ErrSlowConsumer)
+		}
+	}
+
+	return ev, nil
+}
+
+// Subscribe registers a subscriber for the given topics (all topics when
+// none are given). Events published after lastEventID that are still in
+// history are returned for replay; pass "" to skip resumption. An ID from
+// an earlier epoch replays the whole history, since every event in it is
+// new to the client.
+func (b *Broker) Subscribe(lastEventID string, topics ...string) (*Subscription, []Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, ErrBrokerClosed
+	}
+
+	sub := &Subscription{
+		broker: b,
+		ch:     make(chan Event, b.bufferSize),
+		done:   make(chan struct{}),
+	}
+	if len(topics) > 0 {
+		sub.topics = make(map[string]bool, len(topics))
+		for _, t := range topics {
+			sub.topics[t] = true
+		}
+	}
+
+	var replay []Event
+	if last, ok := b.lastSeq(lastEventID); ok {
+		for _, ev := range b.history {
+			if ev.seq > last && sub.matches(ev.Topic) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	b.subs[sub] = struct{}{}
+	return sub, replay, nil
+}
+
+// lastSeq returns the sequence number of the event with id, or 0 for an
+// event from an earlier epoch. It fails for malformed IDs.
+func (b *Broker) lastSeq(id string) (uint64, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if id[:i] != b.epoch {
+		return 0, true
+	}
+	return seq, true
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close ends every subscription and rejects further publishes. It is safe
+// to call more than once and is intended for http.Server.RegisterOnShutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for sub := range b.subs {
+		b.removeLocked(sub, ErrBrokerClosed)
+	}
+}
+
+func (b *Broker) removeLocked(sub *Subscription, err error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.done)
+}
+
+// Subscription receives events from a Broker.
+type Subscription struct {
+	broker *Broker
+	topics map[string]bool
+	ch     chan Event
+	done   chan struct{}
+	err    error
+}
+
+// Events returns the channel of delivered events.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Done is closed when the subscription ends.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err reports why the subscription ended: ErrSlowConsumer, ErrBrokerClosed,
+// or nil after Close.
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.removeLocked(s, nil)
+}
+
+func (s *Subscription) matches(topic string) bool {
+	return s.topics == nil || s.topics[topic]
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev := <-sub.Events():
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := NewBroker(Options{Epoch: "e"})
+
+	all, _, err := b.Subscribe("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	orders, _, _ := b.Subscribe("", "orders")
+
+	if _, err := b.Publish("users", []byte("u1")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b.Publish("orders", []byte("o1"))
+
+	if ev := receive(t, all); ev.Topic != "users" || ev.ID != "e-1" {
+		t.Errorf("Expected users event with ID e-1, got %+v", ev)
+	}
+	if ev := receive(t, all); ev.Topic != "orders" || ev.ID != "e-2" {
+		t.Errorf("Expected orders event with ID e-2, got %+v", ev)
+	}
+	if ev := receive(t, orders); string(ev.Data) != "o1" {
+		t.Errorf("Expected filtered subscriber to get o1, got %q", ev.Data)
+	}
+
+	if n := b.Subscribers(); n != 2 {
+		t.Errorf("Expected 2 subscribers, got %d", n)
+	}
+	orders.Close()
+	orders.Close()
+	if n := b.Subscribers(); n != 1 {
+		t.Errorf("Expected 1 subscriber after close, got %d", n)
+	}
+	if err := orders.Err(); err != nil {
+		t.Errorf("Expected nil error after Close, got %v", err)
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b := NewBroker(Options{HistorySize: 3, Epoch: "e"})
+
+	for i := 0; i < 5; i++ {
+		b.Publish("t", []byte{byte('a' + i)})
+	}
+
+	// Events 3..5 remain in history; resuming after 3 replays 4 and 5.
+	_, replay, err := b.Subscribe("e-3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(replay) != 2 || replay[0].ID != "e-4" || replay[1].ID != "e-5" {
+		t.Errorf("Expected replay of events 4 and 5, got %+v", replay)
+	}
+
+	// An ID from before a restart replays everything retained, even if its
+	// sequence number is ahead of this process.
+	if _, replay, _ := b.Subscribe("d-4"); len(replay) != 3 || replay[0].ID != "e-3" {
+		t.Errorf("Expected replay of the whole history for an earlier epoch, got %+v", replay)
+	}
+
+	// Malformed IDs do not replay anything.
+	for _, id := range []string{"bogus", "3", "e-x"} {
+		if _, replay, _ := b.Subscribe(id); len(replay) != 0 {
+			t.Errorf("Expected no replay for malformed ID %q, got %d events", id, len(replay))
+		}
+	}
+}
+
+func TestEpochDefaults(t *testing.T) {
+	first, _ := NewBroker(Options{}).Publish("t", nil)
+	time.Sleep(time.Millisecond)
+	second, _ := NewBroker(Options{}).Publish("t", nil)
+
+	if first.ID == second.ID {
+		t.Errorf("Expected brokers created at different times to use different IDs, got %s twice", first.ID)
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	b := NewBroker(Options{BufferSize: 1})
+
+	sub, _, _ := b.Subscribe("")
+	b.Publish("t", []byte("1"))
+	b.Publish("t", []byte("2")) // buffer full
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected slow subscriber to be disconnected")
+	}
+	if !errors.Is(sub.Err(), ErrSlowConsumer) {
+		t.Errorf("Expected ErrSlowConsumer, got %v", sub.Err())
+	}
+	if n := b.Subscribers(); n != 0 {
+		t.Errorf("Expected 0 subscribers, got %d", n)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(Options{})
+	sub, _, _ := b.Subscribe("")
+
+	b.Close()
+	b.Close()
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatal("Expected subscription to end when broker closes")
+	}
+	if !errors.Is(sub.Err(), ErrBrokerClosed) {
+		t.Errorf("Expected ErrBrokerClosed, got %v", sub.Err())
+	}
+	if _, err := b.Publish("t", nil); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Expected ErrBrokerClosed from Publish, got %v", err)
+	}
+	if _, _, err := b.Subscribe(""); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Expected ErrBrokerClosed from Subscribe, got %v", err)
+	}
+}
@@ -2,25 +2,57 @@ package handlers
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
+
+	"github.com/eminent85/go-app/internal/auth"
+	"github.com/eminent85/go-app/internal/buildinfo"
+	"github.com/eminent85/go-app/internal/config"
 	"github.com/eminent85/go-app/internal/metrics"
+	"github.com/eminent85/go-app/pkg/health"
 )
 
 // MetricsResponse represents the metrics endpoint response.
 type MetricsResponse struct {
-	TotalRequests   uint64         `json:"total_requests"`
-	ActiveRequests  int64          `json:"active_requests"`
-	ErrorCount      uint64         `json:"error_count"`
-	ErrorRate       float64        `json:"error_rate_percent"`
-	AverageDuration string         `json:"average_duration"`
-	Uptime          string         `json:"uptime"`
-	StatusCodes     map[int]uint64 `json:"status_codes"`
+	TotalRequests   uint64                   `json:"total_requests"`
+	ActiveRequests  int64                    `json:"active_requests"`
+	ErrorCount      uint64                   `json:"error_count"`
+	ErrorRate       float64                  `json:"error_rate_percent"`
+	AverageDuration string                   `json:"average_duration"`
+	Uptime          string                   `json:"uptime"`
+	StatusCodes     map[int]uint64           `json:"status_codes"`
+	WebSocket       WebSocketStats           `json:"websocket"`
+	BuildInfo       map[string]string        `json:"build_info,omitempty"`
+	Runtime         metrics.RuntimeStats     `json:"runtime"`
+	Process         *metrics.ProcessStats    `json:"process,omitempty"`
+	Histograms      []metrics.FamilySnapshot `json:"histograms,omitempty"`
+	Overload        []metrics.FamilySnapshot `json:"overload,omitempty"`
+	Custom          []metrics.FamilySnapshot `json:"custom,omitempty"`
+}
+
+// WebSocketStats summarizes WebSocket activity in the metrics response.
+type WebSocketStats struct {
+	ActiveConnections int64  `json:"active_connections"`
+	TotalConnections  uint64 `json:"total_connections"`
+	MessagesReceived  uint64 `json:"messages_received"`
+	MessagesSent      uint64 `json:"messages_sent"`
 }
 
-// MetricsHandler returns metrics data.
+// MetricsHandler returns metrics data. Prometheus scrapers (or any client
+// asking for text/plain or ?format=prometheus) receive the text exposition
+// format; everyone else gets JSON.
 func MetricsHandler(m *metrics.Metrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept")
+		if wantsPrometheus(r) {
+			w.Header().Set("Content-Type", metrics.PrometheusContentType)
+			w.WriteHeader(http.StatusOK)
+			_ = m.WritePrometheus(w)
+			return
+		}
+
 		response := MetricsResponse{
 			TotalRequests:   m.RequestCount(),
 			ActiveRequests:  m.ActiveRequests(),
@@ -29,6 +61,15 @@ func MetricsHandler(m *metrics.Metrics) http.HandlerFunc {
 			AverageDuration: m.AverageDuration().String(),
 			Uptime:          m.Uptime().String(),
 			StatusCodes:     m.StatusCodes(),
+			WebSocket:       webSocketStats(m),
+			BuildInfo:       m.BuildInfo(),
+			Runtime:         metrics.ReadRuntimeStats(),
+			Histograms:      m.Histograms(),
+			Overload:        m.Overload(),
+			Custom:          m.Registry().Snapshot(),
+		}
+		if stats, err := metrics.ReadProcessStats(); err == nil {
+			response.Process = &stats
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -37,6 +78,179 @@ func MetricsHandler(m *metrics.Metrics) http.HandlerFunc {
 	}
 }
 
+func webSocketStats(m *metrics.Metrics) WebSocketStats {
+	received, sent := m.WebSocketMessages()
+	return WebSocketStats{
+		ActiveConnections: m.WebSocketConnections(),
+		TotalConnections:  m.WebSocketConnectionsTotal(),
+		MessagesReceived:  received,
+		MessagesSent:      sent,
+	}
+}
+
+// wantsPrometheus reports whether the client asked for the Prometheus text
+// format: it must prefer text/plain or OpenMetrics to JSON by q-value.
+// Clients accepting anything, such as browsers and curl, get JSON.
+func wantsPrometheus(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "prometheus"
+	}
+	accept := r.Header.Get("Accept")
+	plain, _ := health.AcceptQuality(accept, "text/plain")
+	openMetrics, _ := health.AcceptQuality(accept, "application/openmetrics-text")
+	jsonQ, _ := health.AcceptQuality(accept, "application/json")
+	return max(plain, openMetrics) > jsonQ
+}
+
+// VersionHandler returns build information about the running binary.
+func VersionHandler(info buildinfo.Info) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(info)
+	}
+}
+
+// ConfigResponse is the configuration reported by ConfigHandler. Settings
+// are copied field by field, so secrets and the paths of the files holding
+// them are only reported as whether they are configured. New settings are
+// not reported until they are added here.
+type ConfigResponse struct {
+	Environment string                 `json:"environment"`
+	ServiceID   string                 `json:"service_id"`
+	Server      ServerConfigResponse   `json:"server"`
+	Admin       AdminConfigResponse    `json:"admin"`
+	Overload    OverloadConfigResponse `json:"overload"`
+	Auth        AuthConfigResponse     `json:"auth"`
+	CORS        []string               `json:"cors_allowed_origins"`
+	RateLimit   int                    `json:"rate_limit_per_second"`
+	Debug       bool                   `json:"debug_enabled"`
+	Security    bool                   `json:"security_headers_enabled"`
+}
+
+// ServerConfigResponse reports the public listener settings.
+type ServerConfigResponse struct {
+	Address         string            `json:"address"`
+	TLS             bool              `json:"tls"`
+	TLSMinVersion   string            `json:"tls_min_version,omitempty"`
+	TLSCipherPolicy string            `json:"tls_cipher_policy,omitempty"`
+	TLSClientAuth   string            `json:"tls_client_auth,omitempty"`
+	H2C             bool              `json:"h2c"`
+	UpgradeEnabled  bool              `json:"upgrade_enabled"`
+	ReadTimeout     string            `json:"read_timeout"`
+	WriteTimeout    string            `json:"write_timeout"`
+	IdleTimeout     string            `json:"idle_timeout"`
+	ShutdownTimeout string            `json:"shutdown_timeout"`
+	RequestTimeout  string            `json:"request_timeout"`
+	RouteTimeouts   map[string]string `json:"route_timeouts,omitempty"`
+	MaxBodyBytes    int64             `json:"max_body_bytes"`
+	RouteBodyLimits map[string]int64  `json:"route_body_limits,omitempty"`
+}
+
+// AdminConfigResponse reports the admin listener settings.
+type AdminConfigResponse struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address,omitempty"`
+}
+
+// OverloadConfigResponse reports the concurrency limits.
+type OverloadConfigResponse struct {
+	MaxConcurrent int            `json:"max_concurrent"`
+	RouteLimits   map[string]int `json:"route_limits,omitempty"`
+	MaxQueue      int            `json:"max_queue"`
+	Adaptive      bool           `json:"adaptive"`
+}
+
+// AuthConfigResponse reports which credentials are accepted.
+type AuthConfigResponse struct {
+	APIKeys     bool   `json:"api_keys"`
+	JWTIssuer   string `json:"jwt_issuer,omitempty"`
+	JWTAudience string `json:"jwt_audience,omitempty"`
+	Webhooks    bool   `json:"webhooks"`
+}
+
+// ConfigHandler returns the effective configuration. It is mounted on the
+// admin listener, or behind the debug token without one.
+func ConfigHandler(cfg *config.Config) http.HandlerFunc {
+	response := configResponse(cfg)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+func configResponse(cfg *config.Config) ConfigResponse {
+	server := ServerConfigResponse{
+		Address:         cfg.Server.Address(),
+		TLS:             cfg.Server.TLSEnabled(),
+		H2C:             cfg.Server.H2C,
+		UpgradeEnabled:  cfg.Server.UpgradeEnabled,
+		ReadTimeout:     cfg.Server.ReadTimeout.String(),
+		WriteTimeout:    cfg.Server.WriteTimeout.String(),
+		IdleTimeout:     cfg.Server.IdleTimeout.String(),
+		ShutdownTimeout: cfg.Server.ShutdownTimeout.String(),
+		RequestTimeout:  cfg.Server.RequestTimeout.String(),
+		MaxBodyBytes:    cfg.Server.MaxBodyBytes,
+		RouteBodyLimits: cfg.Server.RouteBodyLimits,
+	}
+	if server.TLS {
+		server.TLSMinVersion = cfg.Server.TLSMinVersion
+		server.TLSCipherPolicy = cfg.Server.TLSCipherPolicy
+		server.TLSClientAuth = cfg.Server.TLSClientAuth
+	}
+	if len(cfg.Server.RouteTimeouts) > 0 {
+		server.RouteTimeouts = make(map[string]string, len(cfg.Server.RouteTimeouts))
+		for pattern, timeout := range cfg.Server.RouteTimeouts {
+			server.RouteTimeouts[pattern] = timeout.String()
+		}
+	}
+
+	admin := AdminConfigResponse{Enabled: cfg.Admin.Enabled()}
+	if admin.Enabled {
+		admin.Address = cfg.Admin.Address()
+	}
+
+	return ConfigResponse{
+		Environment: cfg.Server.Environment,
+		ServiceID:   cfg.Server.ServiceID,
+		Server:      server,
+		Admin:       admin,
+		Overload: OverloadConfigResponse{
+			MaxConcurrent: cfg.Overload.MaxConcurrent,
+			RouteLimits:   cfg.Overload.RouteLimits,
+			MaxQueue:      cfg.Overload.MaxQueue,
+			Adaptive:      cfg.Overload.AdaptiveEnabled,
+		},
+		Auth: AuthConfigResponse{
+			APIKeys:     cfg.Auth.APIKeysFile != "",
+			JWTIssuer:   cfg.Auth.JWTIssuer,
+			JWTAudience: cfg.Auth.JWTAudience,
+			Webhooks:    cfg.Webhooks.Enabled(),
+		},
+		CORS:      cfg.CORS.AllowedOrigins,
+		RateLimit: cfg.RateLimit.RequestsPerSecond,
+		Debug:     cfg.Debug.Enabled,
+		Security:  cfg.Security.HeadersEnabled,
+	}
+}
+
+// RoutesHandler lists every route of router with the access it requires,
+// for auditing.
+func RoutesHandler(router chi.Routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		routes, err := auth.Routes(router)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(routes)
+	}
+}
+
 // HelloHandler is a simple example endpoint.
 func HelloHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
@@ -48,6 +262,28 @@ func HelloHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// WebhookHandler is an example endpoint for signed partner webhooks. It
+// acknowledges the verified delivery.
+func WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]any{
+		"status": "accepted",
+		"bytes":  len(body),
+	}
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		response["partner"] = p.Name
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
 // NotFoundHandler handles 404 errors.
 func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"bufio"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/eminent85/go-app/internal/buildinfo"
+	"github.com/eminent85/go-app/internal/config"
+	"github.com/eminent85/go-app/internal/events"
 	"github.com/eminent85/go-app/internal/metrics"
 )
 
@@ -93,4 +100,204 @@ func TestMetricsHandler(t *testing.T) {
 	if response.StatusCodes[500] != 1 {
 		t.Errorf("Expected 1 request with status 500, got %d", response.StatusCodes[500])
 	}
+
+	if response.Runtime.Goroutines == 0 {
+		t.Error("Expected runtime goroutine count to be reported")
+	}
+}
+
+func TestWantsPrometheus(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		query    string
+		expected bool
+	}{
+		{name: "no accept", expected: false},
+		{name: "anything", accept: "*/*", expected: false},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: false},
+		{name: "prometheus", accept: "text/plain;version=0.0.4;q=0.5,*/*;q=0.1", expected: true},
+		{name: "openmetrics", accept: "application/openmetrics-text;version=1.0.0,*/*;q=0.2", expected: true},
+		{name: "text refused", accept: "text/plain;q=0, */*", expected: false},
+		{name: "json preferred", accept: "application/json, text/plain;q=0.5", expected: false},
+		{name: "text wildcard", accept: "text/*, application/json;q=0.5", expected: true},
+		{name: "not a media type", accept: "text/plainly", expected: false},
+		{name: "query overrides", accept: "text/plain", query: "?format=json", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics"+tt.query, http.NoBody)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := wantsPrometheus(req); got != tt.expected {
+				t.Errorf("Expected %v for %q, got %v", tt.expected, tt.accept, got)
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerPrometheus(t *testing.T) {
+	m := metrics.New()
+	m.SetBuildInfo(map[string]string{"version": "1.0.0", "commit": "abc123"})
+	m.RecordRequest()
+	m.RecordResponse(200, 100)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	w := httptest.NewRecorder()
+
+	MetricsHandler(m)(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != metrics.PrometheusContentType {
+		t.Errorf("Expected Content-Type %s, got %s", metrics.PrometheusContentType, ct)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Expected Vary: Accept, got %q", vary)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"http_requests_total 1\n",
+		`http_responses_total{code="200"} 1`,
+		`build_info{commit="abc123",version="1.0.0"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	info := buildinfo.New("1.0.0", "abc123", "2024-01-01T00:00:00Z")
+
+	req := httptest.NewRequest(http.MethodGet, "/version", http.NoBody)
+	w := httptest.NewRecorder()
+
+	VersionHandler(info)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response buildinfo.Info
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Version != "1.0.0" || response.Commit != "abc123" {
+		t.Errorf("Unexpected version info: %+v", response)
+	}
+
+	if response.GoVersion == "" {
+		t.Error("Expected Go version to be set")
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Port: "8080", TLSCertFile: "/etc/tls/tls.crt", TLSKeyFile: "/etc/tls/tls.key"},
+		Admin:    config.AdminConfig{Port: "9090"},
+		Debug:    config.DebugConfig{Enabled: true, Token: "s3cr3t"},
+		Auth:     config.AuthConfig{APIKeysFile: "/etc/go-app/api-keys.json"},
+		Webhooks: config.WebhookConfig{SecretsFile: "/etc/go-app/webhooks.json"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/config", http.NoBody)
+	w := httptest.NewRecorder()
+
+	ConfigHandler(cfg)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	for _, secret := range []string{"s3cr3t", "/etc/tls", "/etc/go-app"} {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("Expected %s to be omitted from the config dump, got %s", secret, w.Body.String())
+		}
+	}
+
+	var response ConfigResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Server.Address != ":8080" || !response.Admin.Enabled || !response.Server.TLS {
+		t.Errorf("Unexpected config: %+v", response)
+	}
+	if !response.Auth.APIKeys || !response.Auth.Webhooks {
+		t.Errorf("Expected configured credentials to be reported, got %+v", response.Auth)
+	}
+}
+
+func TestSSEWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	sse, err := NewSSEWriter(w)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sse.Retry(3 * time.Second)
+	sse.Comment("heartbeat")
+	sse.Send("7", "orders", []byte("line1\nline2"))
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	expected := "retry: 3000\n\n: heartbeat\n\nid: 7\nevent: orders\ndata: line1\ndata: line2\n\n"
+	if body := w.Body.String(); body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+}
+
+func TestSSEHandler(t *testing.T) {
+	b := events.NewBroker(events.Options{Epoch: "e"})
+	b.Publish("orders", []byte("first"))
+	b.Publish("orders", []byte("second"))
+
+	srv := httptest.NewServer(SSEHandler(b, SSEOptions{Heartbeat: time.Hour}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?topic=orders", http.NoBody)
+	req.Header.Set("Last-Event-ID", "e-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Unexpected read error: %v", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	// Resumption replays only events after Last-Event-ID.
+	if ev := readEvent(); ev != "id: e-2\nevent: orders\ndata: second\n" {
+		t.Errorf("Unexpected replayed event %q", ev)
+	}
+
+	b.Publish("users", []byte("ignored"))
+	b.Publish("orders", []byte("live"))
+	if ev := readEvent(); ev != "id: e-4\nevent: orders\ndata: live\n" {
+		t.Errorf("Unexpected live event %q", ev)
+	}
+
+	// Closing the broker ends the stream.
+	b.Close()
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected clean end of stream, got %v", err)
+	}
 }
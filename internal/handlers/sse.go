@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eminent85/go-app/internal/events"
+)
+
+// SSEOptions configures the Server-Sent Events handler.
+type SSEOptions struct {
+	// Retry is the reconnection delay suggested to clients. Zero omits the
+	// hint and leaves the browser default.
+	Retry time.Duration
+	// Heartbeat is the interval between keep-alive comments, which stop
+	// proxies from closing idle streams. Zero disables heartbeats.
+	Heartbeat time.Duration
+	// Logger receives streaming errors. Defaults to log.Default().
+	Logger *log.Logger
+}
+
+// SSEWriter writes events in the text/event-stream format.
+type SSEWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewSSEWriter sets the event stream headers and clears any server write
+// deadline so the stream can outlive WriteTimeout. It fails if the writer
+// cannot be flushed.
+func NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	rc := http.NewResponseController(w)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+
+	// Not every writer supports deadlines (e.g. test recorders); streaming
+	// still works there, only without the deadline reset.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, fmt.Errorf("streaming unsupported: %w", err)
+	}
+
+	return &SSEWriter{w: w, rc: rc}, nil
+}
+
+// Send writes an event with an optional ID and event name and flushes it.
+// Multi-line data is split into several data fields.
+func (s *SSEWriter) Send(id, event string, data []byte) error {
+	var buf bytes.Buffer
+	if id != "" {
+		buf.WriteString("id: ")
+		buf.WriteString(sanitizeField(id))
+		buf.WriteByte('\n')
+	}
+	if event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(sanitizeField(event))
+		buf.WriteByte('\n')
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *SSEWriter) Retry(d time.Duration) error {
+	return s.write([]byte(fmt.Sprintf("retry: %d\n\n", d.Milliseconds())))
+}
+
+// Comment writes a comment line, ignored by clients; used for heartbeats.
+func (s *SSEWriter) Comment(text string) error {
+	return s.write([]byte(": " + sanitizeField(text) + "\n\n"))
+}
+
+func (s *SSEWriter) write(b []byte) error {
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// sanitizeField strips line breaks that would end a field early.
+func sanitizeField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// SSEHandler streams broker events to the client. Clients choose topics with
+// repeated ?topic= parameters and resume with the Last-Event-ID header (or
+// ?lastEventId= for clients that cannot set headers). The stream ends when the
+// client disconnects, the subscriber falls behind, or the broker closes.
+func SSEHandler(b *events.Broker, opts SSEOptions) http.HandlerFunc {
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("lastEventId")
+		}
+
+		sub, replay, err := b.Subscribe(lastEventID, r.URL.Query()["topic"]...)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"Event stream unavailable"}` + "\n"))
+			return
+		}
+		defer sub.Close()
+
+		sse, err := NewSSEWriter(w)
+		if err != nil {
+			opts.Logger.Printf("sse: %v", err)
+			return
+		}
+
+		if opts.Retry > 0 {
+			if err := sse.Retry(opts.Retry); err != nil {
+				return
+			}
+		}
+
+		for _, ev := range replay {
+			if err := sse.Send(ev.ID, ev.Topic, ev.Data); err != nil {
+				return
+			}
+		}
+
+		var heartbeat <-chan time.Time
+		if opts.Heartbeat > 0 {
+			ticker := time.NewTicker(opts.Heartbeat)
+			defer ticker.Stop()
+			heartbeat = ticker.C
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-sub.Done():
+				return
+			case <-heartbeat:
+				if err := sse.Comment("heartbeat"); err != nil {
+					return
+				}
+			case ev := <-sub.Events():
+				if err := sse.Send(ev.ID, ev.Topic, ev.Data); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
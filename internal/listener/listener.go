@@ -0,0 +1,179 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks an address as a Unix domain socket path.
+const unixPrefix = "unix://"
+
+// ErrReusePortUnsupported is returned when SO_REUSEPORT is requested on a
+// platform that does not provide it.
+var ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+// Options describes how to open a listener.
+type Options struct {
+	// Address is "host:port" for TCP or "unix:///path/to.sock" for a Unix
+	// domain socket.
+	Address string
+	// SocketMode is applied to Unix socket files. Zero keeps the umask
+	// default.
+	SocketMode fs.FileMode
+	// ReusePort sets SO_REUSEPORT on TCP sockets so a new process can bind
+	// the same port while the old one drains.
+	ReusePort bool
+}
+
+// Listen opens a listener for opts.Address.
+func Listen(ctx context.Context, opts Options) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(opts.Address, unixPrefix); ok {
+		return listenUnix(ctx, path, opts.SocketMode)
+	}
+
+	var lc net.ListenConfig
+	if opts.ReusePort {
+		lc.Control = setReusePort
+	}
+	return lc.Listen(ctx, "tcp", opts.Address)
+}
+
+// listenUnix listens on a Unix socket, replacing a stale socket file left by
+// a previous process. The file is removed when the listener is closed.
+func listenUnix(ctx context.Context, path string, mode fs.FileMode) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("empty unix socket path")
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("setting socket mode: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// Named is an inherited listener and the name it was passed with.
+type Named struct {
+	Name string
+	net.Listener
+}
+
+// Inherited holds inherited listeners in descriptor order. Taken listeners
+// are cleared so the rest can be closed.
+type Inherited []Named
+
+// Index returns the position of the listener named name, or -1.
+func (l Inherited) Index(name string) int {
+	return slices.IndexFunc(l, func(n Named) bool { return n.Name == name })
+}
+
+// TakeAt removes and returns the listener at position i, or nil if there is
+// none.
+func (l Inherited) TakeAt(i int) net.Listener {
+	if i < 0 || i >= len(l) {
+		return nil
+	}
+	ln := l[i].Listener
+	l[i].Listener = nil
+	return ln
+}
+
+// Close closes the listeners that were not taken and returns their names.
+func (l Inherited) Close() []string {
+	var names []string
+	for i := range l {
+		if ln := l.TakeAt(i); ln != nil {
+			ln.Close()
+			names = append(names, l[i].Name)
+		}
+	}
+	return names
+}
+
+// Activated returns listeners passed by systemd-style socket activation
+// (LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES). Descriptors without a name
+// are named by their position: "0", "1" and so on. It returns no listeners
+// when the process was not socket activated, and clears the variables so
+// child processes do not inherit them.
+func Activated() (Inherited, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+	return FromFiles(listenFDsStart, count, names)
+}
+
+// FromFiles wraps count inherited listening sockets starting at descriptor
+// first. Each is named by the matching entry in names, or by its position
+// when names is shorter. Names need not be unique: systemd gives every
+// socket of a unit the unit's name unless FileDescriptorName= is set, so
+// callers fall back to positions for those.
+func FromFiles(first, count int, names []string) (Inherited, error) {
+	listeners := make(Inherited, 0, count)
+	var err error
+	for i := 0; i < count; i++ {
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(first+i), name)
+		// FileListener duplicates the descriptor, so the original is closed
+		// and not leaked to child processes. Every descriptor is wrapped
+		// and closed even after an error.
+		ln, lnErr := net.FileListener(f)
+		f.Close()
+		if lnErr != nil {
+			if err == nil {
+				err = fmt.Errorf("inherited listener %s: %w", name, lnErr)
+			}
+			continue
+		}
+		listeners = append(listeners, Named{Name: name, Listener: ln})
+	}
+	if err != nil {
+		listeners.Close()
+		return nil, err
+	}
+	return listeners, nil
+}
@@ -0,0 +1,168 @@
+package listener
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+
+	ln, err := Listen(context.Background(), Options{Address: "unix://" + path, SocketMode: 0o600})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected socket file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to dial socket: %v", err)
+	}
+	conn.Close()
+	ln.Close()
+
+	// A stale socket file from a crashed process is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err = Listen(context.Background(), Options{Address: "unix://" + path})
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced, got %v", err)
+	}
+	ln.Close()
+}
+
+func TestListenUnixRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Listen(context.Background(), Options{Address: "unix://" + path}); err == nil {
+		t.Error("Expected error when the path is not a socket")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected regular file to be left alone: %v", err)
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not available on Windows")
+	}
+
+	first, err := Listen(context.Background(), Options{Address: "127.0.0.1:0", ReusePort: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer first.Close()
+
+	second, err := Listen(context.Background(), Options{Address: first.Addr().String(), ReusePort: true})
+	if err != nil {
+		t.Fatalf("Expected second listener on the same port, got %v", err)
+	}
+	second.Close()
+
+	if ln, err := Listen(context.Background(), Options{Address: first.Addr().String()}); err == nil {
+		ln.Close()
+		t.Error("Expected error binding a used port without SO_REUSEPORT")
+	}
+}
+
+func TestFromFiles(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listeners, err := FromFiles(int(f.Fd()), 1, []string{"http"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ln := listeners.TakeAt(listeners.Index("http"))
+	if ln == nil {
+		t.Fatalf("Expected listener named http, got %v", listeners)
+	}
+	defer ln.Close()
+
+	if ln.Addr().String() != tcp.Addr().String() {
+		t.Errorf("Expected address %s, got %s", tcp.Addr(), ln.Addr())
+	}
+	if names := listeners.Close(); len(names) != 0 {
+		t.Errorf("Expected taken listener not to be closed, got %v", names)
+	}
+}
+
+func TestFromFilesDuplicateNames(t *testing.T) {
+	// Two consecutive descriptors for two sockets, as systemd passes them
+	var files []*os.File
+	for range 2 {
+		tcp, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tcp.Close()
+		f, err := tcp.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	if int(files[1].Fd()) != int(files[0].Fd())+1 {
+		t.Skip("descriptors are not consecutive")
+	}
+
+	// systemd names both after the unit when FileDescriptorName= is unset
+	listeners, err := FromFiles(int(files[0].Fd()), 2, []string{"go-app.socket", "go-app.socket"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listeners.Close()
+
+	if len(listeners) != 2 {
+		t.Fatalf("Expected 2 listeners, got %d", len(listeners))
+	}
+	for i, n := range listeners {
+		if n.Name != "go-app.socket" {
+			t.Errorf("Expected listener %d named go-app.socket, got %q", i, n.Name)
+		}
+	}
+}
+
+func TestActivatedIgnoresOtherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := Activated()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(listeners) != 0 {
+		t.Errorf("Expected no listeners, got %d", len(listeners))
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("Expected LISTEN_FDS to be cleared")
+	}
+}
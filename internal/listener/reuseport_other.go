@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package listener
+
+import "syscall"
+
+// setReusePort fails on platforms without SO_REUSEPORT.
+func setReusePort(network, address string, c syscall.RawConn) error {
+	return ErrReusePortUnsupported
+}
@@ -0,0 +1,7 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly || (linux && !386 && !amd64 && !arm)
+
+package listener
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -15,16 +15,173 @@ type Metrics struct {
 	startTime      time.Time
 	mu             sync.RWMutex
 	statusCodes    map[int]uint64
+	buildInfo      map[string]string
+	registry       *Registry
+	builtin        *Registry
+	requestSize    *Histogram
+	responseSize   *Histogram
+	overload       *Registry
+	shed           *Counter
+	queued         *Gauge
+	limit          *Gauge
+	timeouts       *Counter
+	websocket      *Registry
+	wsActive       *Gauge
+	wsTotal        *Counter
+	wsMessages     *Counter
 }
 
+// SizeBuckets are histogram buckets for payload sizes in bytes, from 64B
+// to 16MiB in powers of four.
+var SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+// maxRoutes caps the number of distinct routes tracked by per-route metrics.
+const maxRoutes = 500
+
 // New creates a new Metrics instance.
 func New() *Metrics {
+	builtin := NewRegistry()
+	requestSize, _ := builtin.NewHistogram(HistogramOpts{
+		Opts: Opts{
+			Name:      "http_request_size_bytes",
+			Help:      "Size of HTTP request bodies by route.",
+			Labels:    []string{"route"},
+			MaxSeries: maxRoutes,
+		},
+		Buckets: SizeBuckets,
+	})
+	responseSize, _ := builtin.NewHistogram(HistogramOpts{
+		Opts: Opts{
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP response bodies by route.",
+			Labels:    []string{"route"},
+			MaxSeries: maxRoutes,
+		},
+		Buckets: SizeBuckets,
+	})
+
+	overload := NewRegistry()
+	shed, _ := overload.NewCounter(Opts{
+		Name:      "http_requests_shed_total",
+		Help:      "HTTP requests rejected by a concurrency limiter, by limiter and reason.",
+		Labels:    []string{"limiter", "reason"},
+		MaxSeries: maxRoutes,
+	})
+	queued, _ := overload.NewGauge(Opts{
+		Name:      "http_requests_queued",
+		Help:      "HTTP requests waiting for a concurrency limiter slot.",
+		Labels:    []string{"limiter"},
+		MaxSeries: maxRoutes,
+	})
+	limit, _ := overload.NewGauge(Opts{
+		Name:      "http_concurrency_limit",
+		Help:      "Current concurrency limit, by limiter.",
+		Labels:    []string{"limiter"},
+		MaxSeries: maxRoutes,
+	})
+	timeouts, _ := overload.NewCounter(Opts{
+		Name:      "http_request_timeouts_total",
+		Help:      "HTTP requests that exceeded their deadline, by route.",
+		Labels:    []string{"route"},
+		MaxSeries: maxRoutes,
+	})
+
+	websocket := NewRegistry()
+	wsActive, _ := websocket.NewGauge(Opts{
+		Name: "websocket_connections_active",
+		Help: "Number of open WebSocket connections.",
+	})
+	wsTotal, _ := websocket.NewCounter(Opts{
+		Name: "websocket_connections_total",
+		Help: "Total number of WebSocket connections accepted.",
+	})
+	wsMessages, _ := websocket.NewCounter(Opts{
+		Name:   "websocket_messages_total",
+		Help:   "Total number of WebSocket messages by direction.",
+		Labels: []string{"direction"},
+	})
+	// Report zeros before the first connection
+	wsActive.Set(0)
+	wsTotal.Add(0)
+	wsMessages.Add(0, "in")
+	wsMessages.Add(0, "out")
+
 	return &Metrics{
-		startTime:   time.Now(),
-		statusCodes: make(map[int]uint64),
+		startTime:    processStartTime(),
+		statusCodes:  make(map[int]uint64),
+		registry:     NewRegistry(builtinNames...),
+		builtin:      builtin,
+		requestSize:  requestSize,
+		responseSize: responseSize,
+		overload:     overload,
+		shed:         shed,
+		queued:       queued,
+		limit:        limit,
+		timeouts:     timeouts,
+		websocket:    websocket,
+		wsActive:     wsActive,
+		wsTotal:      wsTotal,
+		wsMessages:   wsMessages,
 	}
 }
 
+// Registry returns the registry for application-defined metrics.
+func (m *Metrics) Registry() *Registry {
+	return m.registry
+}
+
+// RecordSizes records request and response body sizes for a route.
+func (m *Metrics) RecordSizes(route string, requestBytes, responseBytes int64) {
+	m.requestSize.Observe(float64(requestBytes), route)
+	m.responseSize.Observe(float64(responseBytes), route)
+}
+
+// Histograms returns a snapshot of the built-in per-route histograms.
+func (m *Metrics) Histograms() []FamilySnapshot {
+	return m.builtin.Snapshot()
+}
+
+// RecordShed records a request rejected by limiter for reason.
+func (m *Metrics) RecordShed(limiter, reason string) {
+	m.shed.Inc(limiter, reason)
+}
+
+// Shed returns the number of requests rejected by limiter for reason.
+func (m *Metrics) Shed(limiter, reason string) uint64 {
+	return uint64(m.shed.Value(limiter, reason))
+}
+
+// AddQueued adjusts the number of requests waiting on limiter.
+func (m *Metrics) AddQueued(limiter string, delta int) {
+	m.queued.Add(float64(delta), limiter)
+}
+
+// SetConcurrencyLimit records the current limit of limiter.
+func (m *Metrics) SetConcurrencyLimit(limiter string, limit int) {
+	m.limit.Set(float64(limit), limiter)
+}
+
+// ConcurrencyLimit returns the last recorded limit of limiter.
+func (m *Metrics) ConcurrencyLimit(limiter string) int {
+	return int(m.limit.Value(limiter))
+}
+
+// RecordTimeout records a request on route that exceeded its deadline.
+func (m *Metrics) RecordTimeout(route string) {
+	m.timeouts.Inc(route)
+}
+
+// Timeouts returns the number of requests on route that exceeded their
+// deadline.
+func (m *Metrics) Timeouts(route string) uint64 {
+	return uint64(m.timeouts.Value(route))
+}
+
+// Overload returns a snapshot of the concurrency limiter and timeout metrics.
+func (m *Metrics) Overload() []FamilySnapshot {
+	return m.overload.Snapshot()
+}
+
 // RecordRequest increments the request counter.
 func (m *Metrics) RecordRequest() {
 	atomic.AddUint64(&m.requestCount, 1)
@@ -78,7 +235,49 @@ func (m *Metrics) AverageDuration() time.Duration {
 	return time.Duration(avgNanos)
 }
 
-// Uptime returns the server uptime.
+// RecordWebSocketOpen records a new WebSocket connection.
+func (m *Metrics) RecordWebSocketOpen() {
+	m.wsTotal.Inc()
+	m.wsActive.Inc()
+}
+
+// RecordWebSocketClose records a closed WebSocket connection.
+func (m *Metrics) RecordWebSocketClose() {
+	m.wsActive.Dec()
+}
+
+// RecordWebSocketMessage records a WebSocket message received from
+// (inbound) or sent to a client.
+func (m *Metrics) RecordWebSocketMessage(inbound bool) {
+	if inbound {
+		m.wsMessages.Inc("in")
+	} else {
+		m.wsMessages.Inc("out")
+	}
+}
+
+// WebSocketConnections returns the number of open WebSocket connections.
+func (m *Metrics) WebSocketConnections() int64 {
+	return int64(m.wsActive.Value())
+}
+
+// WebSocketConnectionsTotal returns the number of WebSocket connections
+// accepted since start.
+func (m *Metrics) WebSocketConnectionsTotal() uint64 {
+	return uint64(m.wsTotal.Value())
+}
+
+// WebSocketMessages returns the number of messages received and sent.
+func (m *Metrics) WebSocketMessages() (received, sent uint64) {
+	return uint64(m.wsMessages.Value("in")), uint64(m.wsMessages.Value("out"))
+}
+
+// totalDurationNanos returns the summed duration of all completed requests.
+func (m *Metrics) totalDurationNanos() uint64 {
+	return atomic.LoadUint64(&m.totalDuration)
+}
+
+// Uptime returns how long the process has been running.
 func (m *Metrics) Uptime() time.Duration {
 	return time.Since(m.startTime)
 }
@@ -95,6 +294,32 @@ func (m *Metrics) StatusCodes() map[int]uint64 {
 	return codes
 }
 
+// SetBuildInfo records the labels reported by the build_info gauge.
+func (m *Metrics) SetBuildInfo(labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buildInfo = make(map[string]string, len(labels))
+	for k, v := range labels {
+		m.buildInfo[k] = v
+	}
+}
+
+// BuildInfo returns a copy of the build_info labels.
+func (m *Metrics) BuildInfo() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.buildInfo == nil {
+		return nil
+	}
+	labels := make(map[string]string, len(m.buildInfo))
+	for k, v := range m.buildInfo {
+		labels[k] = v
+	}
+	return labels
+}
+
 // ErrorRate returns the error rate as a percentage.
 func (m *Metrics) ErrorRate() float64 {
 	requests := atomic.LoadUint64(&m.requestCount)
@@ -1,6 +1,14 @@
 package metrics
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"runtime"
+	rtmetrics "runtime/metrics"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -178,3 +186,335 @@ func TestStatusCodes(t *testing.T) {
 		t.Errorf("Expected 1 request with status 404, got %d", codes[404])
 	}
 }
+
+func TestBuildInfo(t *testing.T) {
+	m := New()
+
+	if info := m.BuildInfo(); info != nil {
+		t.Errorf("Expected nil build info before it is set, got %v", info)
+	}
+
+	labels := map[string]string{"version": "1.0.0"}
+	m.SetBuildInfo(labels)
+	labels["version"] = "mutated"
+
+	if v := m.BuildInfo()["version"]; v != "1.0.0" {
+		t.Errorf("Expected version 1.0.0, got %s", v)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := New()
+	m.SetBuildInfo(map[string]string{"version": "1.0\"beta"})
+	m.RecordRequest()
+	m.RecordResponse(404, 500*time.Millisecond)
+	m.RecordWebSocketOpen()
+	m.RecordWebSocketMessage(true)
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE http_requests_total counter\n",
+		"http_requests_total 1\n",
+		`http_responses_total{code="404"} 1`,
+		"http_request_duration_seconds_sum 0.5\n",
+		`build_info{version="1.0\"beta"} 1`,
+		"# TYPE go_goroutines gauge\n",
+		`go_gc_pause_seconds{quantile="0.99"}`,
+		"go_gc_pause_seconds_sum ",
+		"go_sched_latency_seconds_sum ",
+		"# TYPE websocket_connections_active gauge\n",
+		"websocket_connections_active 1\n",
+		"websocket_connections_total 1\n",
+		`websocket_messages_total{direction="in"} 1`,
+		`websocket_messages_total{direction="out"} 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestShed(t *testing.T) {
+	m := New()
+	m.RecordShed("global", "queue_full")
+	m.RecordShed("global", "queue_full")
+	m.RecordShed("/api/v1/events", "queue_timeout")
+	m.AddQueued("global", 2)
+	m.AddQueued("global", -1)
+	m.SetConcurrencyLimit("global", 40)
+	m.RecordTimeout("/api/v1/hello")
+
+	if got := m.Shed("global", "queue_full"); got != 2 {
+		t.Errorf("Expected 2 shed requests, got %d", got)
+	}
+	if got := m.Shed("/api/v1/events", "queue_timeout"); got != 1 {
+		t.Errorf("Expected 1 shed request, got %d", got)
+	}
+	if got := m.ConcurrencyLimit("global"); got != 40 {
+		t.Errorf("Expected limit 40, got %d", got)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`http_requests_shed_total{limiter="global",reason="queue_full"} 2`,
+		`http_requests_queued{limiter="global"} 1`,
+		`http_concurrency_limit{limiter="global"} 40`,
+		`http_request_timeouts_total{route="/api/v1/hello"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestReadRuntimeStats(t *testing.T) {
+	runtime.GC()
+	stats := ReadRuntimeStats()
+
+	if stats.Goroutines == 0 {
+		t.Error("Expected at least one goroutine")
+	}
+
+	if stats.TotalMemoryBytes == 0 {
+		t.Error("Expected total memory to be reported")
+	}
+
+	if stats.GCCycles == 0 {
+		t.Error("Expected at least one GC cycle after runtime.GC")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	h := &rtmetrics.Float64Histogram{
+		Counts:  []uint64{50, 40, 9, 1},
+		Buckets: []float64{0, 1, 2, 3, math.Inf(1)},
+	}
+
+	d := summarize(h)
+
+	if d.Count != 100 {
+		t.Errorf("Expected count 100, got %d", d.Count)
+	}
+	if d.P50 != 1 || d.P90 != 2 || d.P99 != 3 {
+		t.Errorf("Unexpected quantiles: p50=%v p90=%v p99=%v", d.P50, d.P90, d.P99)
+	}
+	// The last bucket is unbounded, so its lower bound is used.
+	if d.Max != 3 {
+		t.Errorf("Expected max 3, got %v", d.Max)
+	}
+	if d.Sum != 50*1+40*2+9*3+1*3 {
+		t.Errorf("Expected sum estimated from bucket bounds, got %v", d.Sum)
+	}
+
+	if empty := summarize(&rtmetrics.Float64Histogram{Counts: []uint64{0}, Buckets: []float64{0, 1}}); empty.Count != 0 {
+		t.Errorf("Expected empty distribution, got %+v", empty)
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	data := "1234 (go app) S 1 1234 1234 0 -1 4194560 1000 0 0 0 250 50 0 0 20 0 12 0 5000 104857600 2560 " +
+		"18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0"
+
+	var stats ProcessStats
+	if err := parseProcStat(data, 4096, 100, &stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if stats.CPUSeconds != 3 {
+		t.Errorf("Expected 3 CPU seconds, got %v", stats.CPUSeconds)
+	}
+	if stats.VirtualMemoryBytes != 104857600 {
+		t.Errorf("Expected virtual memory 104857600, got %d", stats.VirtualMemoryBytes)
+	}
+	if stats.ResidentMemoryBytes != 2560*4096 {
+		t.Errorf("Expected resident memory %d, got %d", 2560*4096, stats.ResidentMemoryBytes)
+	}
+
+	if err := parseProcStat(data, 4096, 250, &stats); err != nil || stats.CPUSeconds != 1.2 {
+		t.Errorf("Expected 1.2 CPU seconds at 250 ticks per second, got %v (%v)", stats.CPUSeconds, err)
+	}
+
+	if err := parseProcStat("garbage", 4096, 100, &stats); err == nil {
+		t.Error("Expected error for malformed stat")
+	}
+}
+
+func TestParseStartTime(t *testing.T) {
+	stat := "1234 (go app) S 1 1234 1234 0 -1 4194560 1000 0 0 0 250 50 0 0 20 0 12 0 5000 104857600 2560 " +
+		"18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0"
+	procStat := "cpu  1 2 3 4\nbtime 1700000000\nprocesses 42\n"
+
+	start, err := parseStartTime(stat, procStat, 100)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := time.Unix(1700000050, 0); !start.Equal(want) {
+		t.Errorf("Expected start time %v, got %v", want, start)
+	}
+
+	if _, err := parseStartTime(stat, "cpu  1 2 3 4\n", 100); err == nil {
+		t.Error("Expected error without btime")
+	}
+}
+
+func TestParseAuxv(t *testing.T) {
+	var data []byte
+	for _, v := range []uint64{6, 4096, atClockTick, 250, 0, 0} {
+		if strconv.IntSize == 64 {
+			data = binary.NativeEndian.AppendUint64(data, v)
+		} else {
+			data = binary.NativeEndian.AppendUint32(data, uint32(v))
+		}
+	}
+
+	if hz, ok := parseAuxv(data, atClockTick); !ok || hz != 250 {
+		t.Errorf("Expected clock tick 250, got %d (%v)", hz, ok)
+	}
+	if _, ok := parseAuxv(data, 99); ok {
+		t.Error("Expected missing key not to be found")
+	}
+	if _, ok := parseAuxv(data[:3], atClockTick); ok {
+		t.Error("Expected truncated vector not to be parsed")
+	}
+}
+
+func TestRegistryCounterAndGauge(t *testing.T) {
+	m := New()
+	r := m.Registry()
+
+	orders, err := r.NewCounter(Opts{Name: "orders_total", Help: "Orders placed.", Labels: []string{"status"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	orders.Inc("ok")
+	orders.Add(2, "ok")
+	orders.Add(-5, "ok") // ignored
+	orders.Inc("failed")
+
+	if v := orders.Value("ok"); v != 3 {
+		t.Errorf("Expected counter 3, got %v", v)
+	}
+
+	queue, err := r.NewGauge(Opts{Name: "queue_depth", Help: "Items waiting."})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	queue.Set(10)
+	queue.Dec()
+
+	if v := queue.Value(); v != 9 {
+		t.Errorf("Expected gauge 9, got %v", v)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE orders_total counter\n",
+		`orders_total{status="ok"} 3`,
+		`orders_total{status="failed"} 1`,
+		"queue_depth 9\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRegistryHistogram(t *testing.T) {
+	r := NewRegistry()
+
+	h, err := r.NewHistogram(HistogramOpts{
+		Opts:    Opts{Name: "payload_bytes", Labels: []string{"route"}},
+		Buckets: []float64{10, 100},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	h.Observe(5, "/a")
+	h.Observe(10, "/a")
+	h.Observe(50, "/a")
+	h.Observe(500, "/a")
+
+	if c := h.Count("/a"); c != 4 {
+		t.Errorf("Expected 4 observations, got %d", c)
+	}
+
+	snap := r.Snapshot()
+	if len(snap) != 1 || len(snap[0].Series) != 1 {
+		t.Fatalf("Unexpected snapshot: %+v", snap)
+	}
+	series := snap[0].Series[0]
+	if series.Buckets["10"] != 2 || series.Buckets["100"] != 3 || series.Value != 565 {
+		t.Errorf("Unexpected histogram snapshot: %+v", series)
+	}
+
+	var buf bytes.Buffer
+	p := newPromWriter(&buf)
+	r.writePrometheus(p)
+	_ = p.flush()
+	for _, want := range []string{
+		`payload_bytes_bucket{route="/a",le="10"} 2`,
+		`payload_bytes_bucket{route="/a",le="+Inf"} 4`,
+		`payload_bytes_count{route="/a"} 4`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRegistryGuards(t *testing.T) {
+	r := NewRegistry("http_requests_total")
+
+	if _, err := r.NewCounter(Opts{Name: "http_requests_total"}); !errors.Is(err, ErrDuplicateMetric) {
+		t.Errorf("Expected ErrDuplicateMetric for reserved name, got %v", err)
+	}
+
+	if _, err := r.NewCounter(Opts{Name: "jobs_total"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := r.NewGauge(Opts{Name: "jobs_total"}); !errors.Is(err, ErrDuplicateMetric) {
+		t.Errorf("Expected ErrDuplicateMetric, got %v", err)
+	}
+
+	for _, opts := range []Opts{
+		{Name: "bad-name"},
+		{Name: "ok_total", Labels: []string{"__reserved"}},
+		{Name: "ok_total", Labels: []string{"a", "a"}},
+	} {
+		if _, err := r.NewCounter(opts); !errors.Is(err, ErrInvalidMetric) {
+			t.Errorf("Expected ErrInvalidMetric for %+v, got %v", opts, err)
+		}
+	}
+
+	c, err := r.NewCounter(Opts{Name: "logins_total", Labels: []string{"user"}, MaxSeries: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c.Inc("alice")
+	c.Inc("bob")
+	c.Inc("carol")        // over the series cap
+	c.Inc("alice", "bad") // wrong number of labels
+
+	if dropped := r.Dropped("logins_total"); dropped != 2 {
+		t.Errorf("Expected 2 dropped observations, got %d", dropped)
+	}
+	if v := c.Value("carol"); v != 0 {
+		t.Errorf("Expected no series for carol, got %v", v)
+	}
+	if v := c.Value("alice"); v != 1 {
+		t.Errorf("Expected alice to be counted once, got %v", v)
+	}
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultUserHZ is the kernel clock tick rate used by /proc/<pid>/stat CPU
+// times when the auxiliary vector does not report it. It is 100 on every
+// mainstream Linux architecture.
+const defaultUserHZ = 100
+
+// atClockTick is the auxiliary vector key holding the clock tick rate.
+const atClockTick = 17
+
+// ProcessStats holds operating-system level metrics about the process.
+type ProcessStats struct {
+	OpenFDs             uint64  `json:"open_fds"`
+	MaxFDs              uint64  `json:"max_fds"`
+	ResidentMemoryBytes uint64  `json:"resident_memory_bytes"`
+	VirtualMemoryBytes  uint64  `json:"virtual_memory_bytes"`
+	CPUSeconds          float64 `json:"cpu_seconds_total"`
+}
+
+// parseProcStat fills CPU and memory fields from the contents of
+// /proc/<pid>/stat, whose times are in userHZ ticks per second.
+func parseProcStat(data string, pageSize int, userHZ float64, stats *ProcessStats) error {
+	fields, err := statFields(data)
+	if err != nil {
+		return err
+	}
+
+	utime, err := strconv.ParseUint(fields[utimeIdx], 10, 64)
+	if err != nil {
+		return err
+	}
+	stime, err := strconv.ParseUint(fields[stimeIdx], 10, 64)
+	if err != nil {
+		return err
+	}
+	vsize, err := strconv.ParseUint(fields[vsizeIdx], 10, 64)
+	if err != nil {
+		return err
+	}
+	rss, err := strconv.ParseUint(fields[rssIdx], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	stats.CPUSeconds = float64(utime+stime) / userHZ
+	stats.VirtualMemoryBytes = vsize
+	stats.ResidentMemoryBytes = rss * uint64(pageSize)
+	return nil
+}
+
+// Indexes of /proc/<pid>/stat fields returned by statFields.
+const (
+	utimeIdx     = 11
+	stimeIdx     = 12
+	starttimeIdx = 19
+	vsizeIdx     = 20
+	rssIdx       = 21
+)
+
+// statFields splits /proc/<pid>/stat after the command name, so fields[0]
+// is the state (field 3 in proc(5)).
+func statFields(data string) ([]string, error) {
+	// The command name may contain spaces and parentheses, so fields are
+	// counted from the last closing parenthesis.
+	end := strings.LastIndexByte(data, ')')
+	if end < 0 {
+		return nil, errors.New("malformed stat: missing command name")
+	}
+	fields := strings.Fields(data[end+1:])
+	if len(fields) <= rssIdx {
+		return nil, errors.New("malformed stat: too few fields")
+	}
+	return fields, nil
+}
+
+// parseStartTime returns when a process started from its /proc/<pid>/stat,
+// which counts userHZ ticks since boot, and /proc/stat, which holds the
+// boot time.
+func parseStartTime(stat, procStat string, userHZ float64) (time.Time, error) {
+	fields, err := statFields(stat)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ticks, err := strconv.ParseUint(fields[starttimeIdx], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(procStat, "\n") {
+		value, ok := strings.CutPrefix(line, "btime ")
+		if !ok {
+			continue
+		}
+		boot, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		since := time.Duration(float64(ticks) / userHZ * float64(time.Second))
+		return time.Unix(boot, 0).Add(since), nil
+	}
+	return time.Time{}, errors.New("malformed stat: missing btime")
+}
+
+// parseAuxv returns the value of key in an auxiliary vector, as found in
+// /proc/<pid>/auxv: pairs of native-endian words ending with a zero key.
+func parseAuxv(data []byte, key uint64) (uint64, bool) {
+	word := strconv.IntSize / 8
+	for len(data) >= 2*word {
+		var k, v uint64
+		if word == 8 {
+			k, v = binary.NativeEndian.Uint64(data), binary.NativeEndian.Uint64(data[8:])
+		} else {
+			k, v = uint64(binary.NativeEndian.Uint32(data)), uint64(binary.NativeEndian.Uint32(data[4:]))
+		}
+		if k == 0 {
+			break
+		}
+		if k == key {
+			return v, true
+		}
+		data = data[2*word:]
+	}
+	return 0, false
+}
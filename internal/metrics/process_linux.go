@@ -0,0 +1,67 @@
+//go:build linux
+
+package metrics
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// userHZ returns the clock tick rate of /proc times, read once from the
+// auxiliary vector the kernel passed to the process.
+var userHZ = sync.OnceValue(func() float64 {
+	data, err := os.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return defaultUserHZ
+	}
+	if hz, ok := parseAuxv(data, atClockTick); ok && hz > 0 {
+		return float64(hz)
+	}
+	return defaultUserHZ
+})
+
+// processStartTime returns when the process started, falling back to the
+// first call for a process without /proc.
+var processStartTime = sync.OnceValue(func() time.Time {
+	stat, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return time.Now()
+	}
+	procStat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Now()
+	}
+	start, err := parseStartTime(string(stat), string(procStat), userHZ())
+	if err != nil {
+		return time.Now()
+	}
+	return start
+})
+
+// ReadProcessStats reads process metrics from /proc.
+func ReadProcessStats() (ProcessStats, error) {
+	var stats ProcessStats
+
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return stats, err
+	}
+	if err := parseProcStat(string(data), os.Getpagesize(), userHZ(), &stats); err != nil {
+		return stats, err
+	}
+
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return stats, err
+	}
+	stats.OpenFDs = uint64(len(fds))
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err == nil {
+		stats.MaxFDs = limit.Cur
+	}
+
+	return stats, nil
+}
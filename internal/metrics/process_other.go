@@ -0,0 +1,21 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errProcessStatsUnsupported is returned on platforms without /proc.
+var errProcessStatsUnsupported = errors.New("process metrics are not supported on this platform")
+
+// ReadProcessStats is not supported outside Linux.
+func ReadProcessStats() (ProcessStats, error) {
+	return ProcessStats{}, errProcessStatsUnsupported
+}
+
+// processStartTime returns the time of the first call, as the process
+// start time cannot be read outside Linux.
+var processStartTime = sync.OnceValue(time.Now)
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text
+// exposition format written by WritePrometheus.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// builtinNames are the metric families written by WritePrometheus itself;
+// custom metrics may not reuse them.
+var builtinNames = []string{
+	"http_requests_total",
+	"http_requests_in_flight",
+	"http_request_errors_total",
+	"http_responses_total",
+	"http_request_duration_seconds",
+	"process_start_time_seconds",
+	"websocket_connections_active",
+	"websocket_connections_total",
+	"websocket_messages_total",
+	"go_goroutines",
+	"go_heap_objects_bytes",
+	"go_gc_heap_goal_bytes",
+	"go_memory_total_bytes",
+	"go_gc_cycles_total",
+	"go_gc_pause_seconds",
+	"go_sched_latency_seconds",
+	"process_open_fds",
+	"process_max_fds",
+	"process_resident_memory_bytes",
+	"process_virtual_memory_bytes",
+	"process_cpu_seconds_total",
+	"build_info",
+	"http_request_size_bytes",
+	"http_response_size_bytes",
+	"http_requests_shed_total",
+	"http_requests_queued",
+	"http_concurrency_limit",
+	"http_request_timeouts_total",
+	"metrics_dropped_observations_total",
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	p := newPromWriter(w)
+
+	p.family("http_requests_total", "Total number of HTTP requests received.", "counter")
+	p.sample("http_requests_total", float64(m.RequestCount()))
+
+	p.family("http_requests_in_flight", "Number of HTTP requests currently being served.", "gauge")
+	p.sample("http_requests_in_flight", float64(m.ActiveRequests()))
+
+	p.family("http_request_errors_total", "Total number of HTTP responses with a 5xx status code.", "counter")
+	p.sample("http_request_errors_total", float64(m.ErrorCount()))
+
+	p.family("http_responses_total", "Total number of HTTP responses by status code.", "counter")
+	codes := m.StatusCodes()
+	keys := make([]int, 0, len(codes))
+	for code := range codes {
+		keys = append(keys, code)
+	}
+	sort.Ints(keys)
+	for _, code := range keys {
+		p.sample("http_responses_total", float64(codes[code]), "code", strconv.Itoa(code))
+	}
+
+	p.family("http_request_duration_seconds", "Total time spent serving HTTP requests.", "summary")
+	p.sample("http_request_duration_seconds_sum", float64(m.totalDurationNanos())/1e9)
+	p.sample("http_request_duration_seconds_count", float64(m.RequestCount()))
+
+	p.family("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge")
+	p.sample("process_start_time_seconds", float64(m.startTime.UnixNano())/1e9)
+
+	writeRuntime(p, ReadRuntimeStats())
+	if stats, err := ReadProcessStats(); err == nil {
+		writeProcess(p, stats)
+	}
+
+	if info := m.BuildInfo(); info != nil {
+		p.family("build_info", "Build information about the running binary; the value is always 1.", "gauge")
+		p.sample("build_info", 1, sortedLabels(info)...)
+	}
+
+	m.builtin.writePrometheus(p)
+	m.overload.writePrometheus(p)
+	m.websocket.writePrometheus(p)
+	m.registry.writePrometheus(p)
+	writeDropped(p, m.builtin, m.overload, m.websocket, m.registry)
+
+	return p.flush()
+}
+
+func writeRuntime(p *promWriter, stats RuntimeStats) {
+	p.family("go_goroutines", "Number of goroutines that currently exist.", "gauge")
+	p.sample("go_goroutines", float64(stats.Goroutines))
+
+	p.family("go_heap_objects_bytes", "Memory occupied by live and unswept heap objects.", "gauge")
+	p.sample("go_heap_objects_bytes", float64(stats.HeapObjectsBytes))
+
+	p.family("go_gc_heap_goal_bytes", "Heap size target for the end of the GC cycle.", "gauge")
+	p.sample("go_gc_heap_goal_bytes", float64(stats.HeapGoalBytes))
+
+	p.family("go_memory_total_bytes", "All memory mapped by the Go runtime.", "gauge")
+	p.sample("go_memory_total_bytes", float64(stats.TotalMemoryBytes))
+
+	p.family("go_gc_cycles_total", "Number of completed GC cycles.", "counter")
+	p.sample("go_gc_cycles_total", float64(stats.GCCycles))
+
+	p.distribution("go_gc_pause_seconds", "Distribution of stop-the-world pause latencies due to GC.", stats.GCPauses)
+	p.distribution("go_sched_latency_seconds", "Distribution of time goroutines spent runnable before running.", stats.SchedLatency)
+}
+
+func writeProcess(p *promWriter, stats ProcessStats) {
+	p.family("process_open_fds", "Number of open file descriptors.", "gauge")
+	p.sample("process_open_fds", float64(stats.OpenFDs))
+
+	p.family("process_max_fds", "Maximum number of open file descriptors.", "gauge")
+	p.sample("process_max_fds", float64(stats.MaxFDs))
+
+	p.family("process_resident_memory_bytes", "Resident memory size in bytes.", "gauge")
+	p.sample("process_resident_memory_bytes", float64(stats.ResidentMemoryBytes))
+
+	p.family("process_virtual_memory_bytes", "Virtual memory size in bytes.", "gauge")
+	p.sample("process_virtual_memory_bytes", float64(stats.VirtualMemoryBytes))
+
+	p.family("process_cpu_seconds_total", "Total user and system CPU time spent in seconds.", "counter")
+	p.sample("process_cpu_seconds_total", stats.CPUSeconds)
+}
+
+// promWriter renders samples in the Prometheus text format.
+type promWriter struct {
+	w *bufio.Writer
+}
+
+func newPromWriter(w io.Writer) *promWriter {
+	return &promWriter{w: bufio.NewWriter(w)}
+}
+
+// family writes the HELP and TYPE lines for a metric family.
+func (p *promWriter) family(name, help, typ string) {
+	p.w.WriteString("# HELP ")
+	p.w.WriteString(name)
+	p.w.WriteByte(' ')
+	p.w.WriteString(escapeHelp(help))
+	p.w.WriteString("\n# TYPE ")
+	p.w.WriteString(name)
+	p.w.WriteByte(' ')
+	p.w.WriteString(typ)
+	p.w.WriteByte('\n')
+}
+
+// sample writes a single sample. Labels are given as alternating
+// name/value pairs.
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.w.WriteString(name)
+	if len(labels) > 0 {
+		p.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			p.w.WriteString(labels[i])
+			p.w.WriteString(`="`)
+			p.w.WriteString(escapeLabelValue(labels[i+1]))
+			p.w.WriteByte('"')
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteByte(' ')
+	p.w.WriteString(formatFloat(value))
+	p.w.WriteByte('\n')
+}
+
+// distribution writes a runtime latency distribution as a summary.
+func (p *promWriter) distribution(name, help string, d Distribution) {
+	p.family(name, help, "summary")
+	p.sample(name, d.P50, "quantile", "0.5")
+	p.sample(name, d.P90, "quantile", "0.9")
+	p.sample(name, d.P99, "quantile", "0.99")
+	p.sample(name, d.Max, "quantile", "1")
+	p.sample(name+"_sum", d.Sum)
+	p.sample(name+"_count", float64(d.Count))
+}
+
+func (p *promWriter) flush() error {
+	return p.w.Flush()
+}
+
+// sortedLabels flattens a label map into name/value pairs ordered by name.
+func sortedLabels(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, name, labels[name])
+	}
+	return pairs
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,466 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxSeries is the number of distinct label combinations a metric
+// may hold when Opts.MaxSeries is not set.
+const DefaultMaxSeries = 100
+
+// DefaultBuckets are the default histogram buckets, suited to request
+// latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	// ErrDuplicateMetric is returned when a metric name is already registered.
+	ErrDuplicateMetric = errors.New("metric already registered")
+	// ErrInvalidMetric is returned for invalid metric or label names.
+	ErrInvalidMetric = errors.New("invalid metric definition")
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Opts configures a custom metric.
+type Opts struct {
+	Name   string
+	Help   string
+	Labels []string
+	// MaxSeries caps the number of distinct label value combinations.
+	// Observations for new combinations beyond the cap are dropped and
+	// counted in metrics_dropped_observations_total.
+	MaxSeries int
+}
+
+// HistogramOpts configures a custom histogram.
+type HistogramOpts struct {
+	Opts
+	// Buckets are the upper bounds of the histogram buckets. DefaultBuckets
+	// is used when empty.
+	Buckets []float64
+}
+
+// Registry holds application-defined metrics.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+	reserved map[string]bool
+	dropped  sync.Map // metric name -> *uint64
+}
+
+// NewRegistry creates an empty Registry. Reserved names cannot be registered.
+func NewRegistry(reserved ...string) *Registry {
+	r := &Registry{
+		families: make(map[string]*family),
+		reserved: make(map[string]bool, len(reserved)),
+	}
+	for _, name := range reserved {
+		r.reserved[name] = true
+	}
+	return r
+}
+
+// NewCounter registers a monotonically increasing counter.
+func (r *Registry) NewCounter(opts Opts) (*Counter, error) {
+	f, err := r.register(opts, "counter", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Counter{f: f}, nil
+}
+
+// NewGauge registers a gauge that can go up and down.
+func (r *Registry) NewGauge(opts Opts) (*Gauge, error) {
+	f, err := r.register(opts, "gauge", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Gauge{f: f}, nil
+}
+
+// NewHistogram registers a histogram with the given buckets.
+func (r *Registry) NewHistogram(opts HistogramOpts) (*Histogram, error) {
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	if !sort.Float64sAreSorted(buckets) {
+		return nil, fmt.Errorf("%w: %s buckets must be sorted", ErrInvalidMetric, opts.Name)
+	}
+	if math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+	for _, l := range opts.Labels {
+		if l == "le" {
+			return nil, fmt.Errorf("%w: %s uses reserved label le", ErrInvalidMetric, opts.Name)
+		}
+	}
+
+	f, err := r.register(opts.Opts, "histogram", buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &Histogram{f: f}, nil
+}
+
+func (r *Registry) register(opts Opts, typ string, buckets []float64) (*family, error) {
+	if !metricNameRE.MatchString(opts.Name) {
+		return nil, fmt.Errorf("%w: bad metric name %q", ErrInvalidMetric, opts.Name)
+	}
+	seen := make(map[string]bool, len(opts.Labels))
+	for _, l := range opts.Labels {
+		if !labelNameRE.MatchString(l) || strings.HasPrefix(l, "__") || seen[l] {
+			return nil, fmt.Errorf("%w: bad label name %q on %s", ErrInvalidMetric, l, opts.Name)
+		}
+		seen[l] = true
+	}
+
+	maxSeries := opts.MaxSeries
+	if maxSeries <= 0 {
+		maxSeries = DefaultMaxSeries
+	}
+	if len(opts.Labels) == 0 {
+		maxSeries = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reserved[opts.Name] || r.families[opts.Name] != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateMetric, opts.Name)
+	}
+
+	f := &family{
+		name:      opts.Name,
+		help:      opts.Help,
+		typ:       typ,
+		labels:    append([]string(nil), opts.Labels...),
+		buckets:   buckets,
+		maxSeries: maxSeries,
+		series:    make(map[string]*series),
+		registry:  r,
+	}
+	r.families[opts.Name] = f
+	return f, nil
+}
+
+// drop records an observation that was discarded by a guard.
+func (r *Registry) drop(name string) {
+	v, _ := r.dropped.LoadOrStore(name, new(uint64))
+	atomic.AddUint64(v.(*uint64), 1)
+}
+
+// Dropped returns the number of observations discarded for a metric because
+// of label mismatches or the series cap.
+func (r *Registry) Dropped(name string) uint64 {
+	if v, ok := r.dropped.Load(name); ok {
+		return atomic.LoadUint64(v.(*uint64))
+	}
+	return 0
+}
+
+// sortedFamilies returns registered families ordered by name.
+func (r *Registry) sortedFamilies() []*family {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+	return families
+}
+
+// family is a named metric with all its label combinations.
+type family struct {
+	name      string
+	help      string
+	typ       string
+	labels    []string
+	buckets   []float64
+	maxSeries int
+
+	mu       sync.RWMutex
+	series   map[string]*series
+	registry *Registry
+}
+
+// series holds the values for one label combination.
+type series struct {
+	labelValues []string
+	value       uint64 // float64 bits; counters and gauges
+	sum         uint64 // float64 bits; histograms
+	count       uint64
+	buckets     []uint64
+}
+
+// get returns the series for the label values, or nil when the observation
+// must be dropped.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		f.registry.drop(f.name)
+		return nil
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s := f.series[key]
+	f.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s = f.series[key]; s != nil {
+		return s
+	}
+	if len(f.series) >= f.maxSeries {
+		f.registry.drop(f.name)
+		return nil
+	}
+	s = &series{labelValues: append([]string(nil), values...)}
+	if f.buckets != nil {
+		s.buckets = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+// sortedSeries returns all series ordered by label values.
+func (f *family) sortedSeries() []*series {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	list := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].labelValues, "\xff") < strings.Join(list[j].labelValues, "\xff")
+	})
+	return list
+}
+
+// labelPairs returns name/value pairs for a series.
+func (f *family) labelPairs(s *series) []string {
+	pairs := make([]string, 0, 2*len(f.labels))
+	for i, name := range f.labels {
+		pairs = append(pairs, name, s.labelValues[i])
+	}
+	return pairs
+}
+
+func addFloat(addr *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(addr, old, updated) {
+			return
+		}
+	}
+}
+
+func loadFloat(addr *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(addr))
+}
+
+// Counter is a custom counter metric.
+type Counter struct {
+	f *family
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter by delta. Negative deltas are ignored.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	if s := c.f.get(labelValues); s != nil {
+		addFloat(&s.value, delta)
+	}
+}
+
+// Value returns the current counter value for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.f.value(labelValues)
+}
+
+// Gauge is a custom gauge metric.
+type Gauge struct {
+	f *family
+}
+
+// Set sets the gauge for the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	if s := g.f.get(labelValues); s != nil {
+		atomic.StoreUint64(&s.value, math.Float64bits(v))
+	}
+}
+
+// Add adds delta (which may be negative) to the gauge.
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	if s := g.f.get(labelValues); s != nil {
+		addFloat(&s.value, delta)
+	}
+}
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Value returns the current gauge value for the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.f.value(labelValues)
+}
+
+func (f *family) value(labelValues []string) float64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if s := f.series[strings.Join(labelValues, "\xff")]; s != nil {
+		return loadFloat(&s.value)
+	}
+	return 0
+}
+
+// Histogram is a custom histogram metric.
+type Histogram struct {
+	f *family
+}
+
+// Observe records a value for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.f.get(labelValues)
+	if s == nil {
+		return
+	}
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(s.buckets) {
+		atomic.AddUint64(&s.buckets[i], 1)
+	}
+	addFloat(&s.sum, v)
+	atomic.AddUint64(&s.count, 1)
+}
+
+// Count returns the number of observations for the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.f.mu.RLock()
+	defer h.f.mu.RUnlock()
+	if s := h.f.series[strings.Join(labelValues, "\xff")]; s != nil {
+		return atomic.LoadUint64(&s.count)
+	}
+	return 0
+}
+
+// SeriesSnapshot is a point-in-time copy of one label combination.
+type SeriesSnapshot struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Value   float64           `json:"value"`
+	Count   uint64            `json:"count,omitempty"`
+	Buckets map[string]uint64 `json:"buckets,omitempty"`
+}
+
+// FamilySnapshot is a point-in-time copy of a custom metric.
+type FamilySnapshot struct {
+	Name    string           `json:"name"`
+	Help    string           `json:"help,omitempty"`
+	Type    string           `json:"type"`
+	Series  []SeriesSnapshot `json:"series"`
+	Dropped uint64           `json:"dropped,omitempty"`
+}
+
+// Snapshot returns a copy of every custom metric. Histogram values are the
+// sum of observations and buckets are cumulative, keyed by upper bound.
+func (r *Registry) Snapshot() []FamilySnapshot {
+	families := r.sortedFamilies()
+	snapshots := make([]FamilySnapshot, 0, len(families))
+	for _, f := range families {
+		fs := FamilySnapshot{
+			Name:    f.name,
+			Help:    f.help,
+			Type:    f.typ,
+			Dropped: r.Dropped(f.name),
+		}
+		for _, s := range f.sortedSeries() {
+			ss := SeriesSnapshot{}
+			if len(f.labels) > 0 {
+				ss.Labels = make(map[string]string, len(f.labels))
+				for i, name := range f.labels {
+					ss.Labels[name] = s.labelValues[i]
+				}
+			}
+			if f.typ == "histogram" {
+				ss.Value = loadFloat(&s.sum)
+				ss.Count = atomic.LoadUint64(&s.count)
+				ss.Buckets = make(map[string]uint64, len(f.buckets))
+				var cumulative uint64
+				for i, bound := range f.buckets {
+					cumulative += atomic.LoadUint64(&s.buckets[i])
+					ss.Buckets[formatFloat(bound)] = cumulative
+				}
+			} else {
+				ss.Value = loadFloat(&s.value)
+			}
+			fs.Series = append(fs.Series, ss)
+		}
+		snapshots = append(snapshots, fs)
+	}
+	return snapshots
+}
+
+// writePrometheus writes every registered metric.
+func (r *Registry) writePrometheus(p *promWriter) {
+	for _, f := range r.sortedFamilies() {
+		p.family(f.name, f.help, f.typ)
+		for _, s := range f.sortedSeries() {
+			labels := f.labelPairs(s)
+			if f.typ != "histogram" {
+				p.sample(f.name, loadFloat(&s.value), labels...)
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range f.buckets {
+				cumulative += atomic.LoadUint64(&s.buckets[i])
+				p.sample(f.name+"_bucket", float64(cumulative), append(labels, "le", formatFloat(bound))...)
+			}
+			count := atomic.LoadUint64(&s.count)
+			p.sample(f.name+"_bucket", float64(count), append(labels, "le", "+Inf")...)
+			p.sample(f.name+"_sum", loadFloat(&s.sum), labels...)
+			p.sample(f.name+"_count", float64(count), labels...)
+		}
+	}
+}
+
+// writeDropped writes the dropped observation counter across registries.
+func writeDropped(p *promWriter, registries ...*Registry) {
+	p.family("metrics_dropped_observations_total",
+		"Observations discarded because of label mismatches or series limits.", "counter")
+	for _, r := range registries {
+		for _, f := range r.sortedFamilies() {
+			if dropped := r.Dropped(f.name); dropped > 0 {
+				p.sample("metrics_dropped_observations_total", float64(dropped), "metric", f.name)
+			}
+		}
+	}
+}
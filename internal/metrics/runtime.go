@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"math"
+	"runtime/metrics"
+)
+
+// Names of the runtime/metrics samples read by ReadRuntimeStats.
+const (
+	goroutinesMetric   = "/sched/goroutines:goroutines"
+	heapObjectsMetric  = "/memory/classes/heap/objects:bytes"
+	heapGoalMetric     = "/gc/heap/goal:bytes"
+	totalMemoryMetric  = "/memory/classes/total:bytes"
+	gcCyclesMetric     = "/gc/cycles/total:gc-cycles"
+	gcPausesMetric     = "/sched/pauses/total/gc:seconds"
+	schedLatencyMetric = "/sched/latencies:seconds"
+)
+
+// quantiles reported for runtime latency distributions.
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// Distribution summarizes a runtime latency histogram in seconds. The
+// runtime does not record the sum of observations, so Sum is estimated from
+// bucket bounds like the quantiles.
+type Distribution struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// RuntimeStats holds Go runtime metrics.
+type RuntimeStats struct {
+	Goroutines       uint64       `json:"goroutines"`
+	HeapObjectsBytes uint64       `json:"heap_objects_bytes"`
+	HeapGoalBytes    uint64       `json:"heap_goal_bytes"`
+	TotalMemoryBytes uint64       `json:"total_memory_bytes"`
+	GCCycles         uint64       `json:"gc_cycles"`
+	GCPauses         Distribution `json:"gc_pauses_seconds"`
+	SchedLatency     Distribution `json:"sched_latency_seconds"`
+}
+
+// ReadRuntimeStats samples the Go runtime. Metrics unsupported by the
+// running toolchain are left at zero.
+func ReadRuntimeStats() RuntimeStats {
+	samples := []metrics.Sample{
+		{Name: goroutinesMetric},
+		{Name: heapObjectsMetric},
+		{Name: heapGoalMetric},
+		{Name: totalMemoryMetric},
+		{Name: gcCyclesMetric},
+		{Name: gcPausesMetric},
+		{Name: schedLatencyMetric},
+	}
+	metrics.Read(samples)
+
+	var stats RuntimeStats
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			switch s.Name {
+			case goroutinesMetric:
+				stats.Goroutines = v
+			case heapObjectsMetric:
+				stats.HeapObjectsBytes = v
+			case heapGoalMetric:
+				stats.HeapGoalBytes = v
+			case totalMemoryMetric:
+				stats.TotalMemoryBytes = v
+			case gcCyclesMetric:
+				stats.GCCycles = v
+			}
+		case metrics.KindFloat64Histogram:
+			d := summarize(s.Value.Float64Histogram())
+			switch s.Name {
+			case gcPausesMetric:
+				stats.GCPauses = d
+			case schedLatencyMetric:
+				stats.SchedLatency = d
+			}
+		}
+	}
+	return stats
+}
+
+// summarize computes quantiles from a runtime histogram. Each value is the
+// upper bound of the bucket containing the quantile, so results are
+// conservative estimates.
+func summarize(h *metrics.Float64Histogram) Distribution {
+	var d Distribution
+	for _, c := range h.Counts {
+		d.Count += c
+	}
+	if d.Count == 0 {
+		return d
+	}
+
+	values := make([]float64, len(quantiles))
+	var cumulative uint64
+	q := 0
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		cumulative += c
+		d.Sum += float64(c) * bucketBound(h.Buckets, i)
+		for q < len(quantiles) && float64(cumulative) >= quantiles[q]*float64(d.Count) {
+			values[q] = bucketBound(h.Buckets, i)
+			q++
+		}
+		d.Max = bucketBound(h.Buckets, i)
+	}
+	d.P50, d.P90, d.P99 = values[0], values[1], values[2]
+	return d
+}
+
+// bucketBound returns the upper bound of bucket i, falling back to the lower
+// bound for the unbounded last bucket.
+func bucketBound(buckets []float64, i int) float64 {
+	if upper := buckets[i+1]; !math.IsInf(upper, 1) {
+		return upper
+	}
+	return buckets[i]
+}
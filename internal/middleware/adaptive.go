@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/eminent85/go-app/internal/metrics"
+)
+
+// AdaptiveOptions configures a latency-driven concurrency limit. Each Window
+// the average latency is compared with a slowly moving baseline: above
+// Tolerance times the baseline the limit is cut by Backoff, otherwise it
+// grows by its square root if it was reached during the window.
+type AdaptiveOptions struct {
+	MinLimit  int
+	MaxLimit  int
+	Window    time.Duration
+	Tolerance float64
+	Backoff   float64
+}
+
+// baselineWeight is the share of each window's latency folded into the
+// baseline, so a lasting change in handler cost becomes the new normal over
+// a few dozen windows while short spikes still trigger a backoff.
+const baselineWeight = 0.05
+
+// adaptiveLimit adjusts a semaphore's limit from latency samples.
+type adaptiveLimit struct {
+	sem     *semaphore
+	opts    AdaptiveOptions
+	metrics *metrics.Metrics
+	now     func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	samples     int
+	total       time.Duration
+	baseline    float64
+}
+
+func newAdaptiveLimit(sem *semaphore, opts AdaptiveOptions, m *metrics.Metrics) *adaptiveLimit {
+	return &adaptiveLimit{
+		sem:         sem,
+		opts:        opts,
+		metrics:     m,
+		now:         time.Now,
+		windowStart: time.Now(),
+	}
+}
+
+// observe records the latency of an admitted request and recalculates the
+// limit once the window has elapsed.
+func (a *adaptiveLimit) observe(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.samples++
+	a.total += d
+
+	now := a.now()
+	if now.Sub(a.windowStart) < a.opts.Window {
+		return
+	}
+	avg := float64(a.total) / float64(a.samples)
+	a.windowStart = now
+	a.samples = 0
+	a.total = 0
+
+	a.update(avg)
+}
+
+// update applies one window's average latency. a.mu must be held.
+func (a *adaptiveLimit) update(avg float64) {
+	a.sem.mu.Lock()
+	limit := a.sem.limit
+	a.sem.mu.Unlock()
+	saturated := a.sem.resetSaturated()
+
+	switch {
+	case a.baseline == 0:
+		a.baseline = avg
+		return
+	case avg > a.baseline*a.opts.Tolerance:
+		limit -= max(1, int(float64(limit)*(1-a.opts.Backoff)))
+	case saturated:
+		limit += max(1, int(math.Sqrt(float64(limit))))
+	}
+	a.baseline += (avg - a.baseline) * baselineWeight
+
+	limit = min(max(limit, a.opts.MinLimit), a.opts.MaxLimit)
+	a.sem.setLimit(limit)
+	setLimitMetric(a.metrics, a.sem.name, limit)
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// BodyLimitOptions configures BodyLimit.
+type BodyLimitOptions struct {
+	// MaxBytes caps request bodies on routes without an entry in
+	// RouteLimits. Zero means no cap.
+	MaxBytes int64
+	// RouteLimits overrides MaxBytes per chi route pattern. A zero value
+	// removes the cap for that route.
+	RouteLimits map[string]int64
+	// MinRate is the minimum upload throughput in bytes per second, enforced
+	// once Grace has passed since the body was first read. Zero disables it.
+	MinRate int64
+	Grace   time.Duration
+	// ReadTimeout is the server's ReadTimeout. The rate deadlines replace
+	// the one the server set, so they are capped at it to keep slow
+	// clients from holding a body open past the timeout. Zero means none.
+	ReadTimeout time.Duration
+}
+
+// errSlowUpload is returned to handlers reading a body that arrives slower
+// than the minimum rate.
+var errSlowUpload = errors.New("request body upload too slow")
+
+// errBodyTimeout is returned to handlers reading a body that is still
+// arriving when the server's read timeout expires.
+var errBodyTimeout = errors.New("request body read timed out")
+
+// BodyLimit caps request body sizes and drops clients that upload slower
+// than a minimum rate. Bodies declared larger than the cap are rejected with
+// 413 before the handler runs; bodies that grow past it, or arrive too
+// slowly, fail the handler's reads, and if the handler then wrote nothing
+// the client gets 413 or 408 as application/problem+json.
+func BodyLimit(opts BodyLimitOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limit, ok := opts.RouteLimits[findRoutePattern(r)]
+			if !ok {
+				limit = opts.MaxBytes
+			}
+			if limit > 0 && r.ContentLength > limit {
+				WriteProblem(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Request body exceeds %d bytes", limit))
+				return
+			}
+
+			wrapped, rec := wrapResponseWriter(w)
+			body := &limitedBody{
+				ReadCloser: r.Body,
+				limit:      limit,
+				minRate:    opts.MinRate,
+				grace:      opts.Grace,
+				rc:         http.NewResponseController(wrapped),
+			}
+			if opts.ReadTimeout > 0 {
+				// The server's deadline started when it began reading the
+				// request, so this is at most a little later than it.
+				body.readDeadline = time.Now().Add(opts.ReadTimeout)
+			}
+			r.Body = body
+
+			next.ServeHTTP(wrapped, r)
+
+			if rec.written {
+				return
+			}
+			switch {
+			case body.tooLarge:
+				WriteProblem(wrapped, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Request body exceeds %d bytes", limit))
+			case body.tooSlow:
+				WriteProblem(wrapped, http.StatusRequestTimeout,
+					fmt.Sprintf("Request body uploaded slower than %d bytes per second", opts.MinRate))
+			case body.timedOut:
+				WriteProblem(wrapped, http.StatusRequestTimeout,
+					fmt.Sprintf("Request body not received within %s", opts.ReadTimeout))
+			}
+		})
+	}
+}
+
+// limitedBody enforces the size cap and minimum upload rate on a request
+// body. The rate is enforced with read deadlines: after n bytes, the next
+// byte must arrive by start + grace + (n+1)/minRate, and never after
+// readDeadline.
+type limitedBody struct {
+	io.ReadCloser
+	limit        int64
+	minRate      int64
+	grace        time.Duration
+	readDeadline time.Time
+	rc           *http.ResponseController
+
+	n        int64
+	start    time.Time
+	tooLarge bool
+	tooSlow  bool
+	timedOut bool
+	// capped is true when the current deadline is readDeadline rather
+	// than the rate deadline.
+	capped bool
+	// deadlines is false when the connection does not support read
+	// deadlines, in which case the rate is not enforced.
+	deadlines bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.tooLarge {
+		return 0, &http.MaxBytesError{Limit: b.limit}
+	}
+	if b.tooSlow {
+		return 0, errSlowUpload
+	}
+	if b.timedOut {
+		return 0, errBodyTimeout
+	}
+	if b.limit > 0 && int64(len(p)) > b.limit-b.n+1 {
+		// Read one byte past the limit to detect oversized bodies
+		p = p[:b.limit-b.n+1]
+	}
+
+	if b.minRate > 0 {
+		if b.start.IsZero() {
+			b.start = time.Now()
+			b.deadlines = true
+		}
+		if b.deadlines {
+			next := time.Duration(float64(b.n+1) / float64(b.minRate) * float64(time.Second))
+			deadline := b.start.Add(b.grace + next)
+			b.capped = !b.readDeadline.IsZero() && b.readDeadline.Before(deadline)
+			if b.capped {
+				deadline = b.readDeadline
+			}
+			if err := b.rc.SetReadDeadline(deadline); err != nil {
+				b.deadlines = false
+			}
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	if b.limit > 0 && b.n > b.limit {
+		b.tooLarge = true
+		return n - int(b.n-b.limit), &http.MaxBytesError{Limit: b.limit}
+	}
+	if err != nil && b.deadlines && errors.Is(err, os.ErrDeadlineExceeded) {
+		if b.capped {
+			b.timedOut = true
+			return n, errBodyTimeout
+		}
+		b.tooSlow = true
+		return n, errSlowUpload
+	}
+	if errors.Is(err, io.EOF) && b.deadlines {
+		// The body is complete; restore the server's deadline so the rate
+		// deadline does not outlive the upload.
+		_ = b.rc.SetReadDeadline(b.readDeadline)
+	}
+	return n, err
+}
+
+// problem is an RFC 9457 problem details object.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// WriteProblem writes an application/problem+json response.
+func WriteProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/eminent85/go-app/internal/metrics"
+)
+
+// Reasons reported when a request is shed.
+const (
+	ShedQueueFull    = "queue_full"
+	ShedQueueTimeout = "queue_timeout"
+)
+
+// globalLimiter is the limiter label for the global concurrency cap.
+const globalLimiter = "global"
+
+// ConcurrencyOptions configures ConcurrencyLimit.
+type ConcurrencyOptions struct {
+	// MaxConcurrent caps in-flight requests across all routes. Zero means
+	// no global cap. With Adaptive set it is the initial limit.
+	MaxConcurrent int
+	// Adaptive adjusts the global cap from observed latency.
+	Adaptive *AdaptiveOptions
+	// RouteLimits caps in-flight requests per chi route pattern, such as
+	// "/api/v1/events".
+	RouteLimits map[string]int
+	// MaxQueue is how many requests may wait for a slot on each limiter.
+	MaxQueue int
+	// QueueTimeout is the longest a request waits for a slot.
+	QueueTimeout time.Duration
+	// RetryAfter is advertised to shed clients.
+	RetryAfter time.Duration
+	Metrics    *metrics.Metrics
+}
+
+// semaphore bounds concurrency with a resizable limit and a bounded FIFO
+// wait queue.
+type semaphore struct {
+	name     string
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	waiters  []chan struct{}
+	// saturated records that a request found every slot taken since it was
+	// last reset; the adaptive limit only grows when it is actually reached.
+	saturated bool
+}
+
+func newSemaphore(name string, limit int) *semaphore {
+	return &semaphore{name: name, limit: limit}
+}
+
+// acquire takes a slot, waiting up to timeout when the queue has room. It
+// returns the shed reason on failure.
+func (s *semaphore) acquire(ctx context.Context, maxQueue int, timeout time.Duration, m *metrics.Metrics) (string, bool) {
+	s.mu.Lock()
+	if s.inflight < s.limit {
+		s.inflight++
+		s.mu.Unlock()
+		return "", true
+	}
+	s.saturated = true
+	if len(s.waiters) >= maxQueue {
+		s.mu.Unlock()
+		return ShedQueueFull, false
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	s.mu.Unlock()
+
+	if m != nil {
+		m.AddQueued(s.name, 1)
+		defer m.AddQueued(s.name, -1)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return "", true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.waiters {
+		if w == ready {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return ShedQueueTimeout, false
+		}
+	}
+	// A slot was granted while timing out; give it back.
+	s.inflight--
+	s.grant()
+	return ShedQueueTimeout, false
+}
+
+func (s *semaphore) release() {
+	s.mu.Lock()
+	s.inflight--
+	s.grant()
+	s.mu.Unlock()
+}
+
+// setLimit changes the limit, admitting queued requests if it grew.
+// Requests over a reduced limit finish normally.
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	s.limit = limit
+	s.grant()
+	s.mu.Unlock()
+}
+
+// resetSaturated reports whether the limit was reached since the last call.
+func (s *semaphore) resetSaturated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saturated := s.saturated
+	s.saturated = false
+	return saturated
+}
+
+// grant hands free slots to queued requests in arrival order. s.mu must be
+// held.
+func (s *semaphore) grant() {
+	for s.inflight < s.limit && len(s.waiters) > 0 {
+		s.inflight++
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	}
+}
+
+// ConcurrencyLimit caps concurrent requests globally and per route. Requests
+// over a cap wait briefly in a bounded queue; when the queue is full or the
+// wait times out they are shed with 503 and Retry-After.
+//
+// With Adaptive set the global cap follows the latency the Metrics
+// middleware observes, less the time spent queued here, so Metrics must
+// run before ConcurrencyLimit. Streamed responses are not latency samples.
+func ConcurrencyLimit(opts ConcurrencyOptions) func(http.Handler) http.Handler {
+	m := opts.Metrics
+
+	var global *semaphore
+	var adaptive *adaptiveLimit
+	if opts.MaxConcurrent > 0 {
+		global = newSemaphore(globalLimiter, opts.MaxConcurrent)
+		setLimitMetric(m, globalLimiter, opts.MaxConcurrent)
+		if opts.Adaptive != nil {
+			adaptive = newAdaptiveLimit(global, *opts.Adaptive, m)
+		}
+	}
+	routes := make(map[string]*semaphore, len(opts.RouteLimits))
+	for pattern, limit := range opts.RouteLimits {
+		if limit > 0 {
+			routes[pattern] = newSemaphore(pattern, limit)
+			setLimitMetric(m, pattern, limit)
+		}
+	}
+	retryAfter := strconv.Itoa(int((opts.RetryAfter + time.Second - 1) / time.Second))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Take the route slot first so requests queued on a busy route
+			// do not hold global capacity.
+			arrived := time.Now()
+			var held []*semaphore
+			defer func() {
+				for _, s := range held {
+					s.release()
+				}
+			}()
+			for _, s := range []*semaphore{routes[findRoutePattern(r)], global} {
+				if s == nil {
+					continue
+				}
+				reason, ok := s.acquire(r.Context(), opts.MaxQueue, opts.QueueTimeout, m)
+				if !ok {
+					if m != nil {
+						m.RecordShed(s.name, reason)
+					}
+					shed(w, retryAfter)
+					return
+				}
+				held = append(held, s)
+			}
+
+			// Counting the time spent queued would make saturation look
+			// like slow handlers, and the limit would back off into ever
+			// longer queues.
+			if sample := latencySampleFrom(r.Context()); adaptive != nil && sample != nil {
+				sample.queued = time.Since(arrived)
+				sample.observe = adaptive.observe
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setLimitMetric reports the current limit of a limiter.
+func setLimitMetric(m *metrics.Metrics, limiter string, limit int) {
+	if m != nil {
+		m.SetConcurrencyLimit(limiter, limit)
+	}
+}
+
+// findRoutePattern resolves the chi route pattern for r before routing has
+// happened, so limits can be applied in middleware.
+func findRoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+	return rctx.Routes.Find(chi.NewRouteContext(), r.Method, r.URL.Path)
+}
+
+// shed writes the overload response.
+func shed(w http.ResponseWriter, retryAfter string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", retryAfter)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error": "Service overloaded, retry later",
+	})
+}
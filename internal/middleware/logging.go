@@ -6,48 +6,43 @@ import (
 	"time"
 )
 
-// responseWriter wraps http.ResponseWriter to capture status code.
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-	written    bool
+// Logger logs HTTP requests with timing information to the standard logger.
+func Logger(next http.Handler) http.Handler {
+	return NewLogger(log.Default())(next)
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
-	if !rw.written {
-		rw.statusCode = code
-		rw.written = true
-		rw.ResponseWriter.WriteHeader(code)
+// NewLogger returns a request logging middleware that writes to l.
+func NewLogger(l *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			wrapped, rec := wrapResponseWriter(w)
+
+			next.ServeHTTP(wrapped, r)
+
+			duration := time.Since(start)
+			principal := ""
+			if rec.principal != "" {
+				principal = " principal=" + rec.principal
+			}
+			l.Printf(
+				"%s %s %d %s %s%s",
+				r.Method,
+				r.RequestURI,
+				rec.statusCode,
+				duration,
+				r.RemoteAddr,
+				principal,
+			)
+		})
 	}
 }
 
-func (rw *responseWriter) Write(b []byte) (int, error) {
-	if !rw.written {
-		rw.WriteHeader(http.StatusOK)
+// SetLogPrincipal records the authenticated caller for the request log
+// line. It is a no-op unless w was passed down from the logging middleware.
+func SetLogPrincipal(w http.ResponseWriter, name string) {
+	if rec := findRecorder(w); rec != nil {
+		rec.principal = name
 	}
-	return rw.ResponseWriter.Write(b)
-}
-
-// Logger logs HTTP requests with timing information.
-func Logger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		wrapped := &responseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-		}
-
-		next.ServeHTTP(wrapped, r)
-
-		duration := time.Since(start)
-		log.Printf(
-			"%s %s %d %s %s",
-			r.Method,
-			r.RequestURI,
-			wrapped.statusCode,
-			duration,
-			r.RemoteAddr,
-		)
-	})
 }
@@ -1,28 +1,93 @@
 package middleware
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+
 	"github.com/eminent85/go-app/internal/metrics"
 )
 
-// Metrics middleware tracks request metrics.
+// unmatchedRoute labels requests that did not match any route, keeping
+// arbitrary paths out of per-route metrics.
+const unmatchedRoute = "unmatched"
+
+// latencyKey is the context key for the request's *latencySample.
+type latencyKey struct{}
+
+// latencySample hands the duration observed by Metrics to middleware
+// further down the chain. Time spent queued for admission is excluded
+// from the duration passed to observe.
+type latencySample struct {
+	queued  time.Duration
+	observe func(time.Duration)
+}
+
+// latencySampleFrom returns the sample Metrics attached to ctx, or nil.
+func latencySampleFrom(ctx context.Context) *latencySample {
+	sample, _ := ctx.Value(latencyKey{}).(*latencySample)
+	return sample
+}
+
+// Metrics middleware tracks request metrics. The duration of responses
+// that were not streamed also feeds adaptive concurrency limits.
 func Metrics(m *metrics.Metrics) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			m.RecordRequest()
 
-			wrapped := &responseWriter{
-				ResponseWriter: w,
-				statusCode:     http.StatusOK,
+			sample := &latencySample{}
+			r = r.WithContext(context.WithValue(r.Context(), latencyKey{}, sample))
+
+			// Prefer the declared length; count the body as it is read when
+			// the length is unknown (e.g. chunked uploads).
+			var body *countingReader
+			if r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody {
+				body = &countingReader{ReadCloser: r.Body}
+				r.Body = body
 			}
 
+			wrapped, rec := wrapResponseWriter(w)
+
 			next.ServeHTTP(wrapped, r)
 
 			duration := time.Since(start)
-			m.RecordResponse(wrapped.statusCode, duration)
+			m.RecordResponse(rec.statusCode, duration)
+			if sample.observe != nil && !rec.streamed {
+				sample.observe(duration - sample.queued)
+			}
+
+			requestBytes := r.ContentLength
+			if body != nil {
+				requestBytes = body.n
+			}
+			m.RecordSizes(routePattern(r), requestBytes, rec.bytesWritten)
 		})
 	}
 }
+
+// routePattern returns the chi route pattern matched by the request.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return unmatchedRoute
+}
+
+// countingReader counts bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,9 +1,18 @@
 package middleware
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 
 	"github.com/eminent85/go-app/internal/metrics"
 )
@@ -101,3 +110,850 @@ func TestResponseWriterWrite(t *testing.T) {
 		t.Error("Expected written flag to be true")
 	}
 }
+
+func TestResponseWriterCountsBytes(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := &responseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+
+	rw.Write([]byte("hello "))
+	rw.Write([]byte("world"))
+
+	if rw.bytesWritten != 11 {
+		t.Errorf("Expected 11 bytes written, got %d", rw.bytesWritten)
+	}
+}
+
+func TestMetricsSizes(t *testing.T) {
+	m := metrics.New()
+
+	r := chi.NewRouter()
+	r.Use(Metrics(m))
+	r.Post("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Write([]byte("created"))
+	})
+
+	// Declared Content-Length.
+	req := httptest.NewRequest(http.MethodPost, "/items/1", strings.NewReader("0123456789"))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Unknown length is counted as the handler reads the body.
+	req = httptest.NewRequest(http.MethodPost, "/items/2", strings.NewReader("01234"))
+	req.ContentLength = -1
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Unmatched paths share a single series.
+	req = httptest.NewRequest(http.MethodGet, "/nope", http.NoBody)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	sizes := map[string]metrics.FamilySnapshot{}
+	for _, f := range m.Histograms() {
+		sizes[f.Name] = f
+	}
+
+	reqSizes := sizes["http_request_size_bytes"]
+	if len(reqSizes.Series) != 2 {
+		t.Fatalf("Expected 2 request size series, got %+v", reqSizes.Series)
+	}
+	for _, s := range reqSizes.Series {
+		switch s.Labels["route"] {
+		case "/items/{id}":
+			if s.Count != 2 || s.Value != 15 {
+				t.Errorf("Expected 2 requests totalling 15 bytes, got %d and %v", s.Count, s.Value)
+			}
+		case "unmatched":
+			if s.Count != 1 {
+				t.Errorf("Expected 1 unmatched request, got %d", s.Count)
+			}
+		default:
+			t.Errorf("Unexpected route label %q", s.Labels["route"])
+		}
+	}
+
+	for _, s := range sizes["http_response_size_bytes"].Series {
+		if s.Labels["route"] == "/items/{id}" && s.Value != 14 {
+			t.Errorf("Expected 14 response bytes, got %v", s.Value)
+		}
+	}
+}
+
+// plainWriter implements only http.ResponseWriter.
+type plainWriter struct {
+	header http.Header
+	code   int
+}
+
+func (p *plainWriter) Header() http.Header         { return p.header }
+func (p *plainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (p *plainWriter) WriteHeader(code int)        { p.code = code }
+
+// hijackWriter adds http.Hijacker and io.ReaderFrom to plainWriter.
+type hijackWriter struct {
+	plainWriter
+	hijacked bool
+}
+
+func (h *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func (h *hijackWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(io.Discard, r)
+}
+
+func TestWrapResponseWriterInterfaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		w          http.ResponseWriter
+		flusher    bool
+		hijacker   bool
+		readerFrom bool
+	}{
+		{"plain", &plainWriter{header: http.Header{}}, false, false, false},
+		{"recorder", httptest.NewRecorder(), true, false, false},
+		{"hijacker", &hijackWriter{plainWriter: plainWriter{header: http.Header{}}}, false, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped, _ := wrapResponseWriter(tt.w)
+
+			if _, ok := wrapped.(http.Flusher); ok != tt.flusher {
+				t.Errorf("Expected Flusher %v, got %v", tt.flusher, ok)
+			}
+			if _, ok := wrapped.(http.Hijacker); ok != tt.hijacker {
+				t.Errorf("Expected Hijacker %v, got %v", tt.hijacker, ok)
+			}
+			if _, ok := wrapped.(io.ReaderFrom); ok != tt.readerFrom {
+				t.Errorf("Expected ReaderFrom %v, got %v", tt.readerFrom, ok)
+			}
+			if u, ok := wrapped.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != tt.w {
+				t.Error("Expected Unwrap to return the underlying writer")
+			}
+		})
+	}
+}
+
+func TestWrapResponseWriterHijackAndReadFrom(t *testing.T) {
+	hw := &hijackWriter{plainWriter: plainWriter{header: http.Header{}}}
+	wrapped, rec := wrapResponseWriter(hw)
+
+	n, err := wrapped.(io.ReaderFrom).ReadFrom(strings.NewReader("payload"))
+	if err != nil || n != 7 {
+		t.Fatalf("Expected 7 bytes copied, got %d (%v)", n, err)
+	}
+	if rec.bytesWritten != 7 {
+		t.Errorf("Expected 7 bytes recorded, got %d", rec.bytesWritten)
+	}
+
+	hw2 := &hijackWriter{plainWriter: plainWriter{header: http.Header{}}}
+	wrapped, rec = wrapResponseWriter(hw2)
+	if _, _, err := wrapped.(http.Hijacker).Hijack(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !hw2.hijacked {
+		t.Error("Expected underlying writer to be hijacked")
+	}
+	if rec.statusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected status %d after hijack, got %d", http.StatusSwitchingProtocols, rec.statusCode)
+	}
+}
+
+func TestWrapResponseWriterReuse(t *testing.T) {
+	w := httptest.NewRecorder()
+	outer, outerRec := wrapResponseWriter(w)
+	inner, innerRec := wrapResponseWriter(outer)
+
+	if innerRec != outerRec {
+		t.Error("Expected nested wrap to reuse the existing recorder")
+	}
+	if _, ok := inner.(http.Flusher); !ok {
+		t.Error("Expected reused writer to remain a Flusher")
+	}
+}
+
+func TestLoggerAndMetricsPreserveFlusher(t *testing.T) {
+	m := metrics.New()
+
+	var flushed bool
+	handler := Logger(Metrics(m)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("Expected handler writer to implement http.Flusher")
+		}
+		w.Write([]byte("data: hello\n\n"))
+		f.Flush()
+		flushed = true
+
+		// http.ResponseController reaches the recorder through Unwrap.
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Unexpected ResponseController error: %v", err)
+		}
+	})))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", http.NoBody))
+
+	if !flushed || !w.Flushed {
+		t.Error("Expected response to be flushed")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	m := metrics.New()
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+
+	r := chi.NewRouter()
+	r.Use(ConcurrencyLimit(ConcurrencyOptions{
+		MaxConcurrent: 1,
+		MaxQueue:      1,
+		QueueTimeout:  time.Second,
+		RetryAfter:    1500 * time.Millisecond,
+		Metrics:       m,
+	}))
+	r.Get("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	codes := make(chan int, 2)
+	serve := func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", http.NoBody))
+		codes <- w.Code
+	}
+
+	// One request runs, one waits in the queue
+	go serve()
+	<-started
+	go serve()
+	waitFor(t, func() bool { return queued(m, "global") == 1 })
+
+	// The queue is full, so the next request is shed
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", http.NoBody))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+	if got := m.Shed("global", ShedQueueFull); got != 1 {
+		t.Errorf("Expected 1 request shed with queue_full, got %d", got)
+	}
+
+	close(release)
+	for range 2 {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+	}
+	if got := queued(m, "global"); got != 0 {
+		t.Errorf("Expected empty queue, got %v", got)
+	}
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	m := metrics.New()
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+
+	r := chi.NewRouter()
+	r.Use(ConcurrencyLimit(ConcurrencyOptions{
+		RouteLimits:  map[string]int{"/items/{id}": 1},
+		MaxQueue:     10,
+		QueueTimeout: 10 * time.Millisecond,
+		Metrics:      m,
+	}))
+	r.Get("/items/{id}", func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	})
+	r.Get("/other", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	go r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", http.NoBody))
+	<-started
+
+	// The route is saturated and the wait times out
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/2", http.NoBody))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if got := m.Shed("/items/{id}", ShedQueueTimeout); got != 1 {
+		t.Errorf("Expected 1 request shed with queue_timeout, got %d", got)
+	}
+
+	// Other routes are unaffected by the route limit
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other", http.NoBody))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+// queued returns the current queue depth reported for limiter.
+func queued(m *metrics.Metrics, limiter string) float64 {
+	for _, family := range m.Overload() {
+		if family.Name != "http_requests_queued" {
+			continue
+		}
+		for _, series := range family.Series {
+			if series.Labels["limiter"] == limiter {
+				return series.Value
+			}
+		}
+	}
+	return 0
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	m := metrics.New()
+	sem := newSemaphore(globalLimiter, 100)
+	a := newAdaptiveLimit(sem, AdaptiveOptions{
+		MinLimit:  10,
+		MaxLimit:  110,
+		Window:    time.Second,
+		Tolerance: 2,
+		Backoff:   0.5,
+	}, m)
+	m.SetConcurrencyLimit(globalLimiter, 100)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	// window closes one window's worth of samples at the given latency
+	window := func(latency time.Duration, saturated bool) {
+		sem.mu.Lock()
+		sem.saturated = saturated
+		sem.mu.Unlock()
+		a.observe(latency)
+		now = now.Add(time.Second)
+		a.observe(latency)
+	}
+
+	tests := []struct {
+		name      string
+		latency   time.Duration
+		saturated bool
+		expected  int
+	}{
+		{name: "first window sets baseline", latency: 10 * time.Millisecond, saturated: true, expected: 100},
+		{name: "saturated grows", latency: 10 * time.Millisecond, saturated: true, expected: 110},
+		{name: "capped at max", latency: 10 * time.Millisecond, saturated: true, expected: 110},
+		{name: "latency spike backs off", latency: 50 * time.Millisecond, expected: 55},
+		{name: "unsaturated holds", latency: 10 * time.Millisecond, expected: 55},
+		{name: "floored at min", latency: time.Second, expected: 28},
+	}
+
+	for _, tt := range tests {
+		window(tt.latency, tt.saturated)
+		if sem.limit != tt.expected {
+			t.Errorf("%s: expected limit %d, got %d", tt.name, tt.expected, sem.limit)
+		}
+		if got := m.ConcurrencyLimit(globalLimiter); got != tt.expected {
+			t.Errorf("%s: expected limit metric %d, got %d", tt.name, tt.expected, got)
+		}
+	}
+
+	for range 3 {
+		window(time.Second, false)
+	}
+	if sem.limit != 10 {
+		t.Errorf("Expected limit floored at 10, got %d", sem.limit)
+	}
+}
+
+func TestSemaphoreSetLimit(t *testing.T) {
+	sem := newSemaphore(globalLimiter, 1)
+	if _, ok := sem.acquire(t.Context(), 1, time.Second, nil); !ok {
+		t.Fatal("Expected first acquire to succeed")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		_, ok := sem.acquire(t.Context(), 1, 5*time.Second, nil)
+		acquired <- ok
+	}()
+	waitFor(t, func() bool {
+		sem.mu.Lock()
+		defer sem.mu.Unlock()
+		return len(sem.waiters) == 1
+	})
+
+	// Raising the limit admits the queued request
+	sem.setLimit(2)
+	if !<-acquired {
+		t.Error("Expected queued request to be admitted")
+	}
+	if !sem.resetSaturated() {
+		t.Error("Expected semaphore to report saturation")
+	}
+	if sem.resetSaturated() {
+		t.Error("Expected saturation to be reset")
+	}
+}
+
+func TestAdaptiveConcurrencyObservesLatency(t *testing.T) {
+	m := metrics.New()
+	r := chi.NewRouter()
+	r.Use(Metrics(m))
+	r.Use(ConcurrencyLimit(ConcurrencyOptions{
+		MaxConcurrent: 5,
+		Adaptive: &AdaptiveOptions{
+			MinLimit:  1,
+			MaxLimit:  10,
+			Window:    time.Nanosecond,
+			Tolerance: 2,
+			Backoff:   0.9,
+		},
+		Metrics: m,
+	}))
+	r.Get("/fast", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/stream", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.(http.Flusher).Flush()
+	})
+
+	get := func(path string) {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	}
+
+	// The first sample sets the baseline
+	get("/fast")
+	// Streamed responses are not latency samples
+	get("/stream")
+	if got := m.ConcurrencyLimit(globalLimiter); got != 5 {
+		t.Errorf("Expected limit 5 after streamed response, got %d", got)
+	}
+
+	get("/slow")
+	if got := m.ConcurrencyLimit(globalLimiter); got != 4 {
+		t.Errorf("Expected limit 4 after slow response, got %d", got)
+	}
+}
+
+func TestAdaptiveConcurrencyWithoutMetrics(t *testing.T) {
+	m := metrics.New()
+	handler := ConcurrencyLimit(ConcurrencyOptions{
+		MaxConcurrent: 5,
+		Adaptive: &AdaptiveOptions{
+			MinLimit:  1,
+			MaxLimit:  10,
+			Window:    time.Nanosecond,
+			Tolerance: 2,
+			Backoff:   0.9,
+		},
+		Metrics: m,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+
+	// Latency samples come from the Metrics middleware; without it the
+	// limit stays where it started
+	for _, path := range []string{"/fast", "/slow"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	}
+	if got := m.ConcurrencyLimit(globalLimiter); got != 5 {
+		t.Errorf("Expected limit 5 without latency samples, got %d", got)
+	}
+}
+
+func TestAdaptiveConcurrencyIgnoresQueueing(t *testing.T) {
+	m := metrics.New()
+	r := chi.NewRouter()
+	r.Use(Metrics(m))
+	r.Use(ConcurrencyLimit(ConcurrencyOptions{
+		MaxConcurrent: 2,
+		Adaptive: &AdaptiveOptions{
+			MinLimit:  1,
+			MaxLimit:  4,
+			Window:    time.Nanosecond,
+			Tolerance: 2,
+			Backoff:   0.5,
+		},
+		MaxQueue:     100,
+		QueueTimeout: 10 * time.Second,
+		Metrics:      m,
+	}))
+	r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Saturate the limiter: most requests queue for several handler
+	// durations, but handler latency stays flat
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Go(func() {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+		})
+	}
+	wg.Wait()
+
+	if got := m.ConcurrencyLimit(globalLimiter); got < 2 {
+		t.Errorf("Expected limit to hold or grow under queueing, got %d", got)
+	}
+	if got := m.Shed(globalLimiter, ShedQueueTimeout); got != 0 {
+		t.Errorf("Expected no shed requests, got %d", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	m := metrics.New()
+	r := chi.NewRouter()
+	r.Use(Timeout(TimeoutOptions{
+		Default: 20 * time.Millisecond,
+		RouteTimeouts: map[string]time.Duration{
+			"/unbounded": 0,
+			"/short":     time.Millisecond,
+		},
+		Metrics: m,
+	}))
+	wait := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	r.Get("/fast", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/slow", wait)
+	r.Get("/short", wait)
+	r.Get("/handled", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.Get("/unbounded", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("Expected no deadline on /unbounded")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		path     string
+		expected int
+		timeouts uint64
+	}{
+		{path: "/fast", expected: http.StatusOK},
+		{path: "/slow", expected: http.StatusGatewayTimeout, timeouts: 1},
+		{path: "/short", expected: http.StatusGatewayTimeout, timeouts: 1},
+		{path: "/handled", expected: http.StatusInternalServerError, timeouts: 1},
+		{path: "/unbounded", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, http.NoBody))
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if got := m.Timeouts(tt.path); got != tt.timeouts {
+				t.Errorf("Expected %d timeouts, got %d", tt.timeouts, got)
+			}
+			if tt.expected == http.StatusGatewayTimeout && !strings.Contains(w.Body.String(), "Request timed out") {
+				t.Errorf("Expected JSON timeout error, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(BodyLimit(BodyLimitOptions{
+		MaxBytes:    8,
+		RouteLimits: map[string]int64{"/unlimited": 0},
+	}))
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		_, _ = w.Write(body)
+	}
+	r.Post("/upload", echo)
+	r.Post("/unlimited", echo)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		chunked  bool
+		expected int
+	}{
+		{name: "within limit", path: "/upload", body: "12345678", expected: http.StatusOK},
+		{name: "declared too large", path: "/upload", body: "123456789", expected: http.StatusRequestEntityTooLarge},
+		{name: "chunked too large", path: "/upload", body: "123456789", chunked: true, expected: http.StatusRequestEntityTooLarge},
+		{name: "route without limit", path: "/unlimited", body: "123456789", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if tt.expected == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, w.Body.String())
+			}
+			if tt.expected != http.StatusOK {
+				if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Errorf("Expected application/problem+json, got %q", ct)
+				}
+				if !strings.Contains(w.Body.String(), `"status":413`) {
+					t.Errorf("Expected problem details, got %q", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestBodyLimitMinRate(t *testing.T) {
+	handler := BodyLimit(BodyLimitOptions{MinRate: 1000, Grace: 50 * time.Millisecond})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.ReadAll(r.Body); err != nil {
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Declare a large body, send a few bytes and stall
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 100000\r\n\r\nabc")
+	if err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("Expected status 408, got %d", resp.StatusCode)
+	}
+}
+
+func TestBodyLimitReadTimeout(t *testing.T) {
+	const readTimeout = 300 * time.Millisecond
+	handler := BodyLimit(BodyLimitOptions{MinRate: 100, ReadTimeout: readTimeout})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.ReadAll(r.Body); err != nil {
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.ReadTimeout = readTimeout
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Trickle the body at twice the minimum rate; it would take 5s to
+	// arrive in full.
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 1000\r\n\r\n")
+	if err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	go func() {
+		for i := 0; i < 1000; i++ {
+			if _, err := conn.Write([]byte{'a'}); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	start := time.Now()
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("Expected status 408, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the body to be cut off at the read timeout, took %s", elapsed)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	var nonce string
+	handler := SecurityHeaders(SecurityOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentTypeNosniff:    true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		PermissionsPolicy:     "camera=()",
+		ContentSecurityPolicy: "script-src 'nonce-{nonce}'",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	expected := map[string]string{
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Permissions-Policy":        "camera=()",
+		"Content-Security-Policy":   "script-src 'nonce-" + nonce + "'",
+	}
+	for name, value := range expected {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+	if nonce == "" {
+		t.Fatal("Expected a CSP nonce in the request context")
+	}
+
+	// Every request gets a fresh nonce
+	first := nonce
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	if nonce == first {
+		t.Error("Expected a new nonce per request")
+	}
+}
+
+func TestSecurityHeadersReportOnly(t *testing.T) {
+	handler := SecurityHeaders(SecurityOptions{
+		ContentSecurityPolicy: "default-src 'none'",
+		CSPReportOnly:         true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nonce := CSPNonce(r.Context()); nonce != "" {
+			t.Errorf("Expected no nonce, got %q", nonce)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Expected no HSTS header, got %q", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("Expected no enforced CSP, got %q", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy-Report-Only"); got != "default-src 'none'" {
+		t.Errorf("Expected report-only CSP, got %q", got)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name     string
+		header   string
+		remote   string
+		values   []string
+		expected string
+	}{
+		{name: "untrusted peer ignores header", remote: "203.0.113.9:1234", values: []string{"198.51.100.1"},
+			expected: "203.0.113.9"},
+		{name: "trusted peer without header", remote: "10.0.0.1:1234", expected: "10.0.0.1"},
+		{name: "right-most untrusted hop", remote: "10.0.0.1:1234", values: []string{"198.51.100.1, 192.0.2.7, 10.0.0.2"},
+			expected: "192.0.2.7"},
+		{name: "spoofed left-most hop", remote: "10.0.0.1:1234", values: []string{"1.2.3.4", "192.0.2.7"}, expected: "192.0.2.7"},
+		{name: "all hops trusted", remote: "10.0.0.1:1234", values: []string{"10.0.0.3, 10.0.0.2"}, expected: "10.0.0.3"},
+		{name: "invalid hop stops at proxy", remote: "10.0.0.1:1234", values: []string{"192.0.2.7, garbage"},
+			expected: "10.0.0.1"},
+		{name: "IPv6 peer", remote: "[2001:db8::1]:443", values: []string{"2001:db8:1::1, 198.51.100.1"},
+			expected: "198.51.100.1"},
+		{name: "forwarded", header: HeaderForwarded, remote: "10.0.0.1:1234",
+			values:   []string{`for=198.51.100.1;proto=https, for="[2001:db9::17]:4711";by=10.0.0.1`},
+			expected: "2001:db9::17"},
+		{name: "forwarded obfuscated", header: HeaderForwarded, remote: "10.0.0.1:1234", values: []string{"for=_hidden"},
+			expected: "10.0.0.1"},
+		{name: "forwarded ignores X-Forwarded-For", header: HeaderForwarded, remote: "10.0.0.1:1234", expected: "10.0.0.1"},
+		{name: "x-real-ip", header: HeaderXRealIP, remote: "10.0.0.1:1234", values: []string{"192.0.2.7"}, expected: "192.0.2.7"},
+		{name: "unix socket peer", remote: "@", values: []string{"192.0.2.7"}, expected: "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(RealIPOptions{TrustedProxies: trusted, Header: tt.header})(
+				http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got = r.RemoteAddr }))
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remote
+			header := tt.header
+			if header == "" {
+				header = HeaderXForwardedFor
+			}
+			for _, v := range tt.values {
+				req.Header.Add(header, v)
+			}
+			if tt.header == HeaderForwarded {
+				req.Header.Set(HeaderXForwardedFor, "192.0.2.99")
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expected {
+				t.Errorf("Expected client %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
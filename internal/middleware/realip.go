@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Client address headers understood by RealIP.
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// RealIPOptions configures RealIP.
+type RealIPOptions struct {
+	// TrustedProxies are the networks of proxies whose Header is believed.
+	// When empty, headers are ignored and the peer address is used.
+	TrustedProxies []netip.Prefix
+	// Header is the header the trusted proxies append the client address
+	// to: HeaderForwarded (RFC 7239), HeaderXForwardedFor or
+	// HeaderXRealIP. Defaults to HeaderXForwardedFor. Only one header is
+	// read, since a proxy passes the others through from the client.
+	Header string
+}
+
+// RealIP sets r.RemoteAddr to the client address. When the peer is a
+// trusted proxy, the forwarding chain in the header is walked from the
+// right and the first hop that is not a trusted proxy is the client, so
+// addresses prepended by the client are never used. It must be the first
+// middleware so the rate limiter and the access log see the same address.
+func RealIP(opts RealIPOptions) func(http.Handler) http.Handler {
+	if opts.Header == "" {
+		opts.Header = HeaderXForwardedFor
+	}
+	trusted := func(addr netip.Addr) bool {
+		for _, p := range opts.TrustedProxies {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, ok := parseAddr(r.RemoteAddr); ok {
+				r.RemoteAddr = clientAddr(peer, forwardedHops(r.Header, opts.Header), trusted).String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientAddr returns the right-most hop not in a trusted network. Each hop
+// is only believed if the hop to its right is trusted, so an unparsable
+// hop, e.g. an obfuscated RFC 7239 identifier, stops the walk at the proxy
+// that reported it.
+func clientAddr(peer netip.Addr, hops []string, trusted func(netip.Addr) bool) netip.Addr {
+	client := peer
+	for i := len(hops) - 1; i >= 0 && trusted(client); i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+	}
+	return client
+}
+
+// forwardedHops returns the client addresses recorded in header, from the
+// original client to the last proxy.
+func forwardedHops(h http.Header, header string) []string {
+	var hops []string
+	for _, value := range h.Values(header) {
+		switch header {
+		case HeaderForwarded:
+			for _, element := range splitQuoted(value, ',') {
+				hops = append(hops, forwardedFor(element))
+			}
+		case HeaderXRealIP:
+			hops = append(hops, strings.TrimSpace(value))
+		default:
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+	return hops
+}
+
+// forwardedFor returns the for parameter of an RFC 7239 forwarded-element,
+// or "" if it has none.
+func forwardedFor(element string) string {
+	for _, pair := range splitQuoted(element, ';') {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(name, "for") {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// splitQuoted splits s at sep outside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			i++
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseAddr parses an IP address with an optional port, in the forms used
+// by RemoteAddr, X-Forwarded-For and RFC 7239 ("[2001:db8::1]:4711").
+func parseAddr(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
@@ -8,14 +8,21 @@ import (
 
 // Recovery recovers from panics and returns a 500 error.
 func Recovery(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				log.Printf("panic: %v\n%s", err, debug.Stack())
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
-		}()
+	return NewRecovery(log.Default())(next)
+}
+
+// NewRecovery returns a panic recovery middleware that logs to l.
+func NewRecovery(l *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					l.Printf("panic: %v\n%s", err, debug.Stack())
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}()
 
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps http.ResponseWriter to capture status code and
+// response size.
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode   int
+	written      bool
+	bytesWritten int64
+	// streamed is set once the response is flushed or the connection is
+	// hijacked; its duration is then a connection lifetime, not a latency.
+	streamed bool
+	// principal names the authenticated caller for the request log.
+	principal string
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.written {
+		rw.statusCode = code
+		rw.written = true
+		rw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.written {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying writer so http.ResponseController can reach
+// features the wrapper does not expose.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// recorder returns the wrapper itself; wrapped writers embedding it use this
+// to share state instead of wrapping twice.
+func (rw *responseWriter) recorder() *responseWriter {
+	return rw
+}
+
+// findRecorder returns the recorder of w, following Unwrap through writers
+// added by other middleware such as compression.
+func findRecorder(w http.ResponseWriter) *responseWriter {
+	for w != nil {
+		if r, ok := w.(interface{ recorder() *responseWriter }); ok {
+			return r.recorder()
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// wrapResponseWriter returns a writer that records status and size, plus the
+// recorder holding that state. The returned writer implements http.Flusher,
+// http.Hijacker and io.ReaderFrom exactly when w does. If w was already
+// wrapped by this package, possibly beneath other middleware's writers, it
+// is returned as-is with the existing recorder.
+func wrapResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *responseWriter) {
+	if rec := findRecorder(w); rec != nil {
+		return w, rec
+	}
+
+	rw := &responseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+
+	f, isFlusher := w.(http.Flusher)
+	h, isHijacker := w.(http.Hijacker)
+	rf, isReaderFrom := w.(io.ReaderFrom)
+	fl := flusher{rw, f}
+	hj := hijacker{rw, h}
+	rdr := readerFrom{rw, rf}
+
+	switch {
+	case isFlusher && isHijacker && isReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			readerFrom
+		}{rw, fl, hj, rdr}, rw
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+		}{rw, fl, hj}, rw
+	case isFlusher && isReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			readerFrom
+		}{rw, fl, rdr}, rw
+	case isHijacker && isReaderFrom:
+		return struct {
+			*responseWriter
+			hijacker
+			readerFrom
+		}{rw, hj, rdr}, rw
+	case isFlusher:
+		return struct {
+			*responseWriter
+			flusher
+		}{rw, fl}, rw
+	case isHijacker:
+		return struct {
+			*responseWriter
+			hijacker
+		}{rw, hj}, rw
+	case isReaderFrom:
+		return struct {
+			*responseWriter
+			readerFrom
+		}{rw, rdr}, rw
+	default:
+		return rw, rw
+	}
+}
+
+// flusher exposes http.Flusher of the underlying writer.
+type flusher struct {
+	rw *responseWriter
+	f  http.Flusher
+}
+
+func (f flusher) Flush() {
+	if !f.rw.written {
+		f.rw.WriteHeader(http.StatusOK)
+	}
+	f.rw.streamed = true
+	f.f.Flush()
+}
+
+// hijacker exposes http.Hijacker of the underlying writer.
+type hijacker struct {
+	rw *responseWriter
+	h  http.Hijacker
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := h.h.Hijack()
+	if err == nil {
+		h.rw.streamed = true
+	}
+	if err == nil && !h.rw.written {
+		// The handler now owns the connection; record it as a protocol switch.
+		h.rw.statusCode = http.StatusSwitchingProtocols
+		h.rw.written = true
+	}
+	return conn, buf, err
+}
+
+// readerFrom exposes io.ReaderFrom of the underlying writer, keeping the
+// sendfile fast path available.
+type readerFrom struct {
+	rw *responseWriter
+	r  io.ReaderFrom
+}
+
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	if !r.rw.written {
+		r.rw.WriteHeader(http.StatusOK)
+	}
+	n, err := r.r.ReadFrom(src)
+	r.rw.bytesWritten += n
+	return n, err
+}
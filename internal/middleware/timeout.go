@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/eminent85/go-app/internal/metrics"
+)
+
+// TimeoutOptions configures Timeout.
+type TimeoutOptions struct {
+	// Default is the deadline for routes without an entry in RouteTimeouts.
+	// Zero means no deadline.
+	Default time.Duration
+	// RouteTimeouts overrides Default per chi route pattern. A zero value
+	// disables the deadline for that route.
+	RouteTimeouts map[string]time.Duration
+	Metrics       *metrics.Metrics
+}
+
+// Timeout sets a context deadline on each request. Handlers are expected to
+// stop once the context is done; if the deadline passed and the handler
+// wrote nothing, Timeout responds with 504 and a JSON error. Unlike the
+// server's WriteTimeout, the handler is told through its context and the
+// client gets a response.
+func Timeout(opts TimeoutOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := findRoutePattern(r)
+			timeout, ok := opts.RouteTimeouts[route]
+			if !ok {
+				timeout = opts.Default
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			wrapped, rec := wrapResponseWriter(w)
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+			if opts.Metrics != nil {
+				opts.Metrics.RecordTimeout(route)
+			}
+			if !rec.written {
+				wrapped.Header().Set("Content-Type", "application/json")
+				wrapped.WriteHeader(http.StatusGatewayTimeout)
+				_ = json.NewEncoder(wrapped).Encode(map[string]string{
+					"error": "Request timed out",
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/go-chi/httprate"
+
+	"github.com/eminent85/go-app/internal/auth"
+	"github.com/eminent85/go-app/internal/debug"
+	"github.com/eminent85/go-app/internal/handlers"
+	customMiddleware "github.com/eminent85/go-app/internal/middleware"
+	"github.com/eminent85/go-app/pkg/health"
+)
+
+// router builds the public router.
+func (s *Server) router() *chi.Mux {
+	cfg := s.cfg
+	r := chi.NewRouter()
+
+	// Client address from trusted proxies, first so the access log and the
+	// rate limiter agree on it
+	r.Use(customMiddleware.RealIP(customMiddleware.RealIPOptions{
+		TrustedProxies: cfg.Server.TrustedProxies,
+		Header:         cfg.Server.RealIPHeader,
+	}))
+
+	// Basic middleware stack
+	r.Use(customMiddleware.NewRecovery(s.logger))
+	r.Use(customMiddleware.NewLogger(s.logger))
+	r.Use(customMiddleware.Metrics(s.metrics))
+
+	// Request ID middleware
+	r.Use(middleware.RequestID)
+
+	// Compression
+	r.Use(middleware.Compress(5))
+
+	// Security headers
+	if cfg.Security.HeadersEnabled {
+		r.Use(s.securityHeaders())
+	}
+
+	// CORS configuration
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: false,
+		MaxAge:           300,
+	}))
+
+	// Rate limiting - per IP
+	r.Use(httprate.LimitByIP(cfg.RateLimit.RequestsPerSecond, time.Second))
+
+	// Signed partner webhooks, built first so their routes get the
+	// verifier's body limit instead of MAX_BODY_BYTES
+	bodyLimits := cfg.Server.RouteBodyLimits
+	var webhooks chi.Router
+	if s.webhooks != nil {
+		webhooks = s.webhookRouter()
+		bodyLimits = webhookBodyLimits(webhooks, bodyLimits, cfg.Webhooks.MaxBodyBytes)
+	}
+
+	// Request body size and upload rate limits
+	r.Use(customMiddleware.BodyLimit(customMiddleware.BodyLimitOptions{
+		MaxBytes:    cfg.Server.MaxBodyBytes,
+		RouteLimits: bodyLimits,
+		MinRate:     cfg.Server.MinUploadRate,
+		Grace:       cfg.Server.UploadRateGrace,
+		ReadTimeout: cfg.Server.ReadTimeout,
+	}))
+
+	// Debug endpoints, served by the admin server when it is enabled
+	if cfg.Debug.Enabled && !s.adminEnabled() {
+		r.Mount("/debug", debug.Handler(cfg.Debug.Token))
+	}
+
+	// Health check endpoints (no rate limiting)
+	s.healthRoutes(r)
+
+	// Metrics endpoint, served by the admin server when it is enabled
+	if !s.adminEnabled() {
+		r.Get("/metrics", handlers.MetricsHandler(s.metrics))
+	}
+
+	// Build information
+	r.Get("/version", handlers.VersionHandler(s.info))
+
+	// Configuration and route audit, served by the admin server when it is
+	// enabled and otherwise guarded by the debug token
+	if !s.adminEnabled() {
+		public := r
+		r.Group(func(r chi.Router) {
+			r.Use(debug.RequireToken(cfg.Debug.Token))
+			r.Get("/config", handlers.ConfigHandler(cfg))
+			r.Get("/routes", handlers.RoutesHandler(public))
+		})
+	}
+
+	// API routes
+	r.Route("/api/v1", func(r chi.Router) {
+		// Authentication, before load shedding so anonymous requests do
+		// not take capacity
+		if len(s.authenticators) > 0 {
+			r.Use(auth.Require(s.authenticators...))
+		}
+
+		// Request deadlines and load shedding, excluding the long-lived
+		// streams below. Shedding applies to API routes only so probes and
+		// metrics keep working under overload.
+		r.Group(func(r chi.Router) {
+			if cfg.Overload.Enabled() {
+				r.Use(s.concurrencyLimit(true))
+			}
+			r.Use(customMiddleware.Timeout(customMiddleware.TimeoutOptions{
+				Default:       cfg.Server.RequestTimeout,
+				RouteTimeouts: cfg.Server.RouteTimeouts,
+				Metrics:       s.metrics,
+			}))
+
+			// Example endpoint
+			r.Get("/hello", handlers.HelloHandler)
+
+			// Add your API endpoints here, with the scopes they require:
+			// r.With(s.requireScopes("orders:write")).Post("/orders", ...)
+		})
+
+		// Streams hold their slot for the whole connection, so they only
+		// count against their route limits, never the global cap
+		r.Group(func(r chi.Router) {
+			if cfg.Overload.Enabled() {
+				r.Use(s.concurrencyLimit(false))
+			}
+
+			// Server-Sent Events stream
+			r.With(s.requireScopes("events:read")).Get("/events", handlers.SSEHandler(s.broker, handlers.SSEOptions{
+				Retry:     cfg.Events.Retry,
+				Heartbeat: cfg.Events.Heartbeat,
+				Logger:    s.logger,
+			}))
+
+			// WebSocket endpoint
+			r.With(s.requireScopes("ws:connect")).Get("/ws", s.hub.ServeHTTP)
+		})
+	})
+
+	// Signed partner webhooks, outside /api/v1 as partners carry no API
+	// credentials
+	if webhooks != nil {
+		r.Mount(webhooksPath, webhooks)
+	}
+
+	// 404 handler
+	r.NotFound(handlers.NotFoundHandler)
+
+	return r
+}
+
+// webhooksPath is where the webhook routes are mounted.
+const webhooksPath = "/webhooks"
+
+// webhookRouter builds the routes for signed partner webhooks.
+func (s *Server) webhookRouter() chi.Router {
+	r := chi.NewRouter()
+	r.Use(auth.VerifyWebhooks(s.webhooks))
+
+	// Example endpoint
+	r.Post("/example", handlers.WebhookHandler)
+
+	// Add your webhook endpoints here
+
+	return r
+}
+
+// webhookBodyLimits adds a body limit of maxBytes for every webhook route
+// to limits, so MAX_BODY_BYTES does not cut off bodies the verifier would
+// accept. Entries already in ROUTE_BODY_LIMITS are kept.
+func webhookBodyLimits(webhooks chi.Routes, limits map[string]int64, maxBytes int64) map[string]int64 {
+	limits = maps.Clone(limits)
+	if limits == nil {
+		limits = make(map[string]int64)
+	}
+	_ = chi.Walk(webhooks, func(_, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if _, ok := limits[webhooksPath+pattern]; !ok {
+			limits[webhooksPath+pattern] = maxBytes
+		}
+		return nil
+	})
+	return limits
+}
+
+// requireScopes returns middleware requiring scopes when authentication is
+// enabled. Without authenticators the API is anonymous and it does nothing.
+func (s *Server) requireScopes(scopes ...string) func(http.Handler) http.Handler {
+	if len(s.authenticators) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return auth.RequireScopes(scopes...)
+}
+
+// securityHeaders builds the security response headers middleware.
+func (s *Server) securityHeaders() func(http.Handler) http.Handler {
+	cfg := s.cfg.Security
+	return customMiddleware.SecurityHeaders(customMiddleware.SecurityOptions{
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		HSTSPreload:           cfg.HSTSPreload,
+		ContentTypeNosniff:    true,
+		FrameOptions:          cfg.FrameOptions,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		PermissionsPolicy:     cfg.PermissionsPolicy,
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		CSPReportOnly:         cfg.CSPReportOnly,
+	})
+}
+
+// concurrencyLimit builds the load shedding middleware for the API routes.
+// The global cap, adaptive or not, applies only when global is set; route
+// limits always apply.
+func (s *Server) concurrencyLimit(global bool) func(http.Handler) http.Handler {
+	cfg := s.cfg.Overload
+
+	maxConcurrent := 0
+	if global {
+		maxConcurrent = cfg.MaxConcurrent
+	}
+	var adaptive *customMiddleware.AdaptiveOptions
+	if global && cfg.AdaptiveEnabled {
+		adaptive = &customMiddleware.AdaptiveOptions{
+			MinLimit:  cfg.AdaptiveMinLimit,
+			MaxLimit:  cfg.AdaptiveMaxLimit,
+			Window:    cfg.AdaptiveWindow,
+			Tolerance: cfg.AdaptiveTolerance,
+			Backoff:   cfg.AdaptiveBackoff,
+		}
+	}
+
+	return customMiddleware.ConcurrencyLimit(customMiddleware.ConcurrencyOptions{
+		MaxConcurrent: maxConcurrent,
+		Adaptive:      adaptive,
+		RouteLimits:   cfg.RouteLimits,
+		MaxQueue:      cfg.MaxQueue,
+		QueueTimeout:  cfg.QueueTimeout,
+		RetryAfter:    cfg.RetryAfter,
+		Metrics:       s.metrics,
+	})
+}
+
+// adminRouter builds the router for the admin listener, which hosts
+// operational endpoints that must not be reachable through the ingress.
+// public is the public router, listed by the route audit endpoint.
+func (s *Server) adminRouter(public chi.Routes) *chi.Mux {
+	cfg := s.cfg
+	r := chi.NewRouter()
+
+	r.Use(customMiddleware.NewRecovery(s.logger))
+	r.Use(middleware.RequestID)
+
+	// Health check endpoints
+	s.healthRoutes(r)
+
+	// Metrics and build information
+	r.Get("/metrics", handlers.MetricsHandler(s.metrics))
+	r.Get("/version", handlers.VersionHandler(s.info))
+
+	// Effective configuration
+	r.Get("/config", handlers.ConfigHandler(cfg))
+
+	// Public routes and the access they require
+	r.Get("/routes", handlers.RoutesHandler(public))
+
+	// Profiling and runtime debugging
+	if cfg.Debug.Enabled {
+		r.Mount("/debug", debug.Handler(cfg.Debug.Token))
+	}
+
+	r.NotFound(handlers.NotFoundHandler)
+
+	return r
+}
+
+// healthRoutes registers the health check endpoints on r.
+func (s *Server) healthRoutes(r chi.Router) {
+	r.Get("/health", health.Handler(s.info.Version, s.now(),
+		health.WithReleaseID(s.info.Commit),
+		health.WithServiceID(s.cfg.Server.ServiceID),
+	))
+	r.Get("/health/ready", health.ReadinessHandler())
+	r.Get("/health/live", health.LivenessHandler())
+}
@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/eminent85/go-app/internal/app"
+	"github.com/eminent85/go-app/internal/auth"
+	"github.com/eminent85/go-app/internal/buildinfo"
+	"github.com/eminent85/go-app/internal/config"
+	"github.com/eminent85/go-app/internal/debug"
+	"github.com/eminent85/go-app/internal/events"
+	"github.com/eminent85/go-app/internal/listener"
+	"github.com/eminent85/go-app/internal/metrics"
+	"github.com/eminent85/go-app/internal/tlsutil"
+	"github.com/eminent85/go-app/internal/upgrade"
+	"github.com/eminent85/go-app/internal/websocket"
+)
+
+// Server is the fully wired application: the public HTTP server, the
+// optional admin server and their background components.
+type Server struct {
+	cfg           *config.Config
+	logger        *log.Logger
+	metrics       *metrics.Metrics
+	now           func() time.Time
+	info          buildinfo.Info
+	listener      net.Listener
+	adminListener net.Listener
+
+	broker         *events.Broker
+	hub            *websocket.Hub
+	authenticators []auth.Authenticator
+	webhooks       *auth.WebhookVerifier
+	srv            *http.Server
+	adminSrv       *http.Server
+	reloader       *tlsutil.CertReloader
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets the logger for requests, panics and lifecycle events.
+func WithLogger(l *log.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithMetrics sets the metrics collector.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithClock sets the time source used for the reported start time.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// WithBuildInfo sets the build information reported by /version, /health
+// and the build_info metric.
+func WithBuildInfo(info buildinfo.Info) Option {
+	return func(s *Server) {
+		s.info = info
+	}
+}
+
+// WithListener serves the public server on ln instead of listening on the
+// configured address.
+func WithListener(ln net.Listener) Option {
+	return func(s *Server) {
+		s.listener = ln
+	}
+}
+
+// WithAdminListener serves the admin server on ln, enabling it even when
+// no admin port is configured.
+func WithAdminListener(ln net.Listener) Option {
+	return func(s *Server) {
+		s.adminListener = ln
+	}
+}
+
+// New builds a Server from cfg. Nothing listens until Run is called.
+func New(cfg *config.Config, opts ...Option) (*Server, error) {
+	s := &Server{
+		cfg:    cfg,
+		logger: log.Default(),
+		now:    time.Now,
+		info:   buildinfo.New("dev", "unknown", "unknown"),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.metrics == nil {
+		s.metrics = metrics.New()
+	}
+	s.metrics.SetBuildInfo(s.info.Labels())
+
+	// Load API credentials; /api/v1 is anonymous when none are configured
+	if cfg.Auth.APIKeysFile != "" {
+		keys, err := auth.LoadKeyStore(cfg.Auth.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		s.authenticators = append(s.authenticators, keys)
+	}
+	if cfg.Auth.JWTEnabled() {
+		verifier, err := auth.NewJWTVerifier(auth.JWTOptions{
+			JWKSURL:         cfg.Auth.JWKSURL,
+			Issuer:          cfg.Auth.JWTIssuer,
+			Audience:        cfg.Auth.JWTAudience,
+			ClockSkew:       cfg.Auth.JWTClockSkew,
+			RefreshInterval: cfg.Auth.JWKSRefreshInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.authenticators = append(s.authenticators, verifier)
+	}
+
+	// Load webhook partner secrets; /webhooks is not served without them
+	if cfg.Webhooks.Enabled() {
+		partners, err := auth.LoadWebhookPartners(cfg.Webhooks.SecretsFile)
+		if err != nil {
+			return nil, err
+		}
+		s.webhooks, err = auth.NewWebhookVerifier(auth.WebhookOptions{
+			Partners:        partners,
+			SignatureHeader: cfg.Webhooks.SignatureHeader,
+			TimestampHeader: cfg.Webhooks.TimestampHeader,
+			PartnerHeader:   cfg.Webhooks.PartnerHeader,
+			Tolerance:       cfg.Webhooks.Tolerance,
+			MaxBodyBytes:    cfg.Webhooks.MaxBodyBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize event broker for streaming endpoints
+	s.broker = events.NewBroker(events.Options{
+		BufferSize:  cfg.Events.BufferSize,
+		HistorySize: cfg.Events.HistorySize,
+	})
+
+	// Initialize WebSocket hub. Browsers send cookies with upgrades from
+	// any page, so the permissive default CORS origins only admit
+	// same-host sockets.
+	wsOrigins := cfg.CORS.AllowedOrigins
+	if cfg.CORS.IsDefault() {
+		wsOrigins = nil
+	}
+	s.hub = websocket.NewHub(websocket.Options{
+		MaxMessageSize: cfg.WebSocket.MaxMessageSize,
+		SendBufferSize: cfg.WebSocket.SendBufferSize,
+		PingInterval:   cfg.WebSocket.PingInterval,
+		PongTimeout:    cfg.WebSocket.PongTimeout,
+		WriteTimeout:   cfg.WebSocket.WriteTimeout,
+		CheckOrigin:    websocket.AllowedOrigins(wsOrigins),
+		Metrics:        s.metrics,
+		Logger:         s.logger,
+		// Example: echo every message back to its sender
+		OnMessage: func(c *websocket.Client, msg websocket.Message) {
+			c.Send(msg)
+		},
+	})
+
+	// Configure server
+	router := s.router()
+	s.srv = &http.Server{
+		Addr:              cfg.Server.Address(),
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ErrorLog:          s.logger,
+	}
+
+	// HTTP/1.1 and HTTP/2 over TLS are always available; h2c optionally
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(cfg.Server.H2C)
+	s.srv.Protocols = protocols
+
+	// Configure TLS with automatic certificate reload
+	if cfg.Server.TLSEnabled() {
+		tlsConfig, reloader, err := tlsutil.NewConfig(tlsutil.Options{
+			CertFile:     cfg.Server.TLSCertFile,
+			KeyFile:      cfg.Server.TLSKeyFile,
+			ClientCAFile: cfg.Server.TLSClientCAFile,
+			ClientAuth:   cfg.Server.TLSClientAuth,
+			MinVersion:   cfg.Server.TLSMinVersion,
+			CipherPolicy: cfg.Server.TLSCipherPolicy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("configuring TLS: %w", err)
+		}
+		s.srv.TLSConfig = tlsConfig
+		s.reloader = reloader
+	}
+
+	// Streaming connections never go idle, so end them when shutdown begins
+	s.srv.RegisterOnShutdown(s.broker.Close)
+
+	// Configure the optional admin server for operational endpoints
+	if s.adminEnabled() {
+		s.adminSrv = &http.Server{
+			Addr:              cfg.Admin.Address(),
+			Handler:           s.adminRouter(router),
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Admin.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+			MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+			ErrorLog:          s.logger,
+		}
+	}
+
+	return s, nil
+}
+
+// inheritedPositions picks the public and admin listeners from inherited,
+// returning -1 for none. Names are matched first; positions are the
+// fallback for unnamed sockets and for systemd, which names every socket
+// after its unit unless FileDescriptorName= is set. Two sockets named
+// "http" or "admin" are ambiguous and rejected.
+func inheritedPositions(inherited listener.Inherited) (public, admin int, err error) {
+	for _, name := range []string{"http", "admin"} {
+		if i := inherited.Index(name); i >= 0 && inherited[i+1:].Index(name) >= 0 {
+			return -1, -1, fmt.Errorf("inherited listeners share the name %q", name)
+		}
+	}
+
+	public, admin = inherited.Index("http"), inherited.Index("admin")
+	if public < 0 && admin != 0 && len(inherited) > 0 {
+		public = 0
+	}
+	if admin < 0 && public != 1 && len(inherited) > 1 {
+		admin = 1
+	}
+	return public, admin, nil
+}
+
+// adminEnabled reports whether operational endpoints move to the admin
+// server.
+func (s *Server) adminEnabled() bool {
+	return s.cfg.Admin.Enabled() || s.adminListener != nil
+}
+
+// Handler returns the public HTTP handler.
+func (s *Server) Handler() http.Handler {
+	return s.srv.Handler
+}
+
+// AdminHandler returns the admin HTTP handler, or nil when the admin server
+// is disabled.
+func (s *Server) AdminHandler() http.Handler {
+	if s.adminSrv == nil {
+		return nil
+	}
+	return s.adminSrv.Handler
+}
+
+// Metrics returns the metrics collector.
+func (s *Server) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// Broker returns the event broker behind the SSE endpoint.
+func (s *Server) Broker() *events.Broker {
+	return s.broker
+}
+
+// Hub returns the WebSocket hub.
+func (s *Server) Hub() *websocket.Hub {
+	return s.hub
+}
+
+// Run starts the servers and background components and blocks until ctx is
+// canceled, a component fails or the listeners are handed to an upgraded
+// process. Every started component is stopped before Run returns. A Server
+// can only be run once.
+func (s *Server) Run(ctx context.Context) error {
+	cfg := s.cfg
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := s.openListeners(ctx); err != nil {
+		return err
+	}
+
+	// Components are started in registration order and stopped in reverse.
+	// The admin server starts first and stops last so metrics and health
+	// stay observable while the main server drains.
+	lifecycle := app.New(s.logger)
+
+	if s.adminSrv != nil {
+		lifecycle.Add("admin server", app.NewHTTPServer(s.adminSrv, s.adminListener),
+			app.WithStopTimeout(cfg.Server.ShutdownTimeout))
+	}
+
+	if s.reloader != nil {
+		lifecycle.Add("certificate reloader", app.NewWorker(func(ctx context.Context) error {
+			s.reloader.Watch(ctx, cfg.Server.TLSReloadInterval, s.logger)
+			return nil
+		}))
+	}
+
+	// Capture profiles to disk on SIGUSR1
+	if cfg.Debug.CaptureDir != "" {
+		lifecycle.Add("profile capture", app.NewWorker(func(ctx context.Context) error {
+			debug.WatchSignal(ctx, cfg.Debug.CaptureDir, cfg.Debug.CaptureDuration, s.logger)
+			return nil
+		}))
+	}
+
+	// Hijacked WebSocket connections are not tracked by srv.Shutdown, so the
+	// hub is stopped after the server.
+	lifecycle.Add("websocket hub", app.Hook{OnStop: s.hub.Shutdown},
+		app.WithStopTimeout(cfg.Server.ShutdownTimeout))
+
+	lifecycle.Add("server", app.NewHTTPServer(s.srv, s.listener),
+		app.DependsOn("websocket hub"),
+		app.WithStopTimeout(cfg.Server.ShutdownTimeout))
+
+	// Tell the process that started us that we are serving
+	if upgrade.Upgrading() {
+		lifecycle.Add("upgrade readiness", app.Hook{OnStart: func(context.Context) error {
+			return upgrade.Ready()
+		}}, app.DependsOn("server"))
+	}
+
+	// Hand the listeners to a new binary on SIGUSR2, then drain
+	if cfg.Server.UpgradeEnabled {
+		listeners := map[string]net.Listener{"http": s.listener}
+		if s.adminListener != nil {
+			listeners["admin"] = s.adminListener
+		}
+		lifecycle.Add("upgrader", app.NewWorker(func(ctx context.Context) error {
+			upgrade.Watch(ctx, listeners, cfg.Server.UpgradeTimeout, s.logger, cancel)
+			return nil
+		}))
+	}
+
+	s.logger.Printf("Starting server on %s (environment: %s, version: %s, commit: %s, built: %s, tls: %t)",
+		s.address(), cfg.Server.Environment, s.info.Version, s.info.Commit, s.info.BuildDate, cfg.Server.TLSEnabled())
+
+	err := lifecycle.Run(ctx)
+	s.logger.Println("Server exited")
+	return err
+}
+
+// address returns the address the public server listens on.
+func (s *Server) address() string {
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.cfg.Server.Address()
+}
+
+// openListeners fills in the listeners that were not injected, preferring
+// sockets handed over by an upgrading parent or passed by socket activation:
+// the one named "http" (or else the first one) for the public server and
+// "admin" (or else the second one) for the admin server.
+func (s *Server) openListeners(ctx context.Context) (err error) {
+	inherited, err := upgrade.Inherited()
+	if err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+	if len(inherited) == 0 {
+		if inherited, err = listener.Activated(); err != nil {
+			return fmt.Errorf("socket activation: %w", err)
+		}
+	}
+	public, admin, err := inheritedPositions(inherited)
+	if err != nil {
+		inherited.Close()
+		return err
+	}
+	take := func(i int) net.Listener {
+		ln := inherited.TakeAt(i)
+		if ln != nil {
+			s.logger.Printf("Using inherited listener %s on %s", inherited[i].Name, ln.Addr())
+		}
+		return ln
+	}
+
+	defer func() {
+		for _, name := range inherited.Close() {
+			s.logger.Printf("Closing unused inherited listener %s", name)
+		}
+		if err != nil {
+			for _, ln := range []net.Listener{s.listener, s.adminListener} {
+				if ln != nil {
+					ln.Close()
+				}
+			}
+		}
+	}()
+
+	if s.listener == nil {
+		s.listener = take(public)
+	}
+	if s.listener == nil {
+		s.listener, err = listener.Listen(ctx, listener.Options{
+			Address:    s.cfg.Server.Address(),
+			SocketMode: s.cfg.Server.SocketMode,
+			ReusePort:  s.cfg.Server.ReusePort,
+		})
+		if err != nil {
+			return fmt.Errorf("listening on %s: %w", s.cfg.Server.Address(), err)
+		}
+	}
+
+	if s.adminSrv == nil {
+		return nil
+	}
+	if s.adminListener == nil {
+		s.adminListener = take(admin)
+	}
+	if s.adminListener == nil {
+		s.adminListener, err = listener.Listen(ctx, listener.Options{
+			Address:   s.cfg.Admin.Address(),
+			ReusePort: s.cfg.Server.ReusePort,
+		})
+		if err != nil {
+			return fmt.Errorf("listening on %s: %w", s.cfg.Admin.Address(), err)
+		}
+	}
+	return nil
+}
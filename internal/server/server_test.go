@@ -0,0 +1,545 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eminent85/go-app/internal/auth"
+	"github.com/eminent85/go-app/internal/buildinfo"
+	"github.com/eminent85/go-app/internal/config"
+	"github.com/eminent85/go-app/internal/listener"
+	"github.com/eminent85/go-app/pkg/health"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func loadConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Server.ShutdownTimeout = 5 * time.Second
+	return cfg
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return ln
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestRun(t *testing.T) {
+	logs := &syncBuffer{}
+	ln := listen(t)
+	adminLn := listen(t)
+
+	srv, err := New(loadConfig(t),
+		WithLogger(log.New(logs, "", 0)),
+		WithListener(ln),
+		WithAdminListener(adminLn),
+		WithBuildInfo(buildinfo.New("1.2.3", "abc123", "2024-01-01T00:00:00Z")),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	public := "http://" + ln.Addr().String()
+	admin := "http://" + adminLn.Addr().String()
+
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{public + "/api/v1/hello", http.StatusOK},
+		{public + "/health/live", http.StatusOK},
+		{public + "/metrics", http.StatusNotFound},
+		{admin + "/metrics", http.StatusOK},
+		{admin + "/health/ready", http.StatusOK},
+		{admin + "/config", http.StatusOK},
+		{admin + "/routes", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code, _ := get(t, tt.url); code != tt.expected {
+			t.Errorf("GET %s: expected status %d, got %d", tt.url, tt.expected, code)
+		}
+	}
+
+	if _, body := get(t, public+"/version"); !strings.Contains(body, `"version":"1.2.3"`) {
+		t.Errorf("Expected injected build info, got %s", body)
+	}
+	if !strings.Contains(logs.String(), "GET /api/v1/hello 200") {
+		t.Errorf("Expected request to be logged to the injected logger, got %q", logs.String())
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return after cancel")
+	}
+
+	if _, err := http.Get(public + "/health/live"); err == nil {
+		t.Error("Expected public server to be closed")
+	}
+}
+
+func TestRunAddressInUse(t *testing.T) {
+	ln := listen(t)
+	defer ln.Close()
+
+	cfg := loadConfig(t)
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	cfg.Server.Host = host
+	cfg.Server.Port = port
+
+	srv, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.Run(context.Background()); err == nil {
+		t.Error("Expected error when the address is in use")
+	}
+}
+
+func TestHandlerWithClock(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	srv, err := New(loadConfig(t),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithClock(func() time.Time { return start }),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if srv.AdminHandler() != nil {
+		t.Error("Expected admin handler to be nil when the admin server is disabled")
+	}
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	code, body := get(t, ts.URL+"/health")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	var response health.Response
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !strings.HasPrefix(response.Uptime, "1h") {
+		t.Errorf("Expected uptime from injected clock, got %s", response.Uptime)
+	}
+
+	// Without an admin server, metrics stay on the public handler.
+	if code, _ := get(t, ts.URL+"/metrics"); code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestNewInvalidTLS(t *testing.T) {
+	cfg := loadConfig(t)
+	cfg.Server.TLSCertFile = "/nonexistent/tls.crt"
+	cfg.Server.TLSKeyFile = "/nonexistent/tls.key"
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for missing certificate files")
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := filepath.Join(t.TempDir(), "keys.json")
+	data := `[{"name": "ci", "hash": "` + auth.HashKey("ci-key") + `"}]`
+	if err := os.WriteFile(keys, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write keys: %v", err)
+	}
+	cfg := loadConfig(t)
+	cfg.Auth.APIKeysFile = keys
+	cfg.Admin.Port = "0"
+
+	logs := &syncBuffer{}
+	srv, err := New(cfg, WithLogger(log.New(logs, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	if code, _ := get(t, ts.URL+"/api/v1/hello"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a key, got %d", http.StatusUnauthorized, code)
+	}
+	if code, _ := get(t, ts.URL+"/health"); code != http.StatusOK {
+		t.Errorf("Expected health checks to stay anonymous, got %d", code)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/hello", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "ci-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/hello: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d with a key, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if !strings.Contains(logs.String(), "principal=ci") {
+		t.Errorf("Expected principal in request log, got:\n%s", logs.String())
+	}
+
+	// The key has no scopes, so scoped routes are forbidden
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/events", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "ci-key")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status %d without the scope, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	admin := httptest.NewServer(srv.AdminHandler())
+	defer admin.Close()
+	_, body := get(t, admin.URL+"/routes")
+	if !strings.Contains(body, `{"method":"GET","pattern":"/api/v1/events","authenticated":true,"scopes":["events:read"]}`) {
+		t.Errorf("Expected scoped events route in listing, got %s", body)
+	}
+
+	cfg.Auth.APIKeysFile = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for missing API keys file")
+	}
+}
+
+func TestAuditWithoutAdmin(t *testing.T) {
+	cfg := loadConfig(t)
+	cfg.Debug.Token = "secret"
+	srv, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"/routes", "/config"} {
+		if code, _ := get(t, ts.URL+path); code != http.StatusUnauthorized {
+			t.Errorf("GET %s: expected status %d without the debug token, got %d", path, http.StatusUnauthorized, code)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, http.NoBody)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected status %d with the debug token, got %d", path, http.StatusOK, resp.StatusCode)
+		}
+		if path == "/routes" && !strings.Contains(string(body), `"pattern":"/api/v1/hello"`) {
+			t.Errorf("Expected public routes in listing, got %s", body)
+		}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	secrets := filepath.Join(t.TempDir(), "webhooks.json")
+	if err := os.WriteFile(secrets, []byte(`[{"name": "acme", "secrets": ["whsec"]}]`), 0o600); err != nil {
+		t.Fatalf("Failed to write secrets: %v", err)
+	}
+	cfg := loadConfig(t)
+	cfg.Webhooks.SecretsFile = secrets
+	// Webhook bodies are capped by WEBHOOK_MAX_BODY_BYTES alone
+	cfg.Server.MaxBodyBytes = 16
+
+	srv, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	body := `{"event":"order.created"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("whsec"))
+	mac.Write([]byte(timestamp + "." + body))
+
+	post := func(signature string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/webhooks/example", strings.NewReader(body))
+		req.Header.Set(cfg.Webhooks.PartnerHeader, "acme")
+		req.Header.Set(cfg.Webhooks.TimestampHeader, timestamp)
+		req.Header.Set(cfg.Webhooks.SignatureHeader, signature)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /webhooks/example: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, _ := post("sha256=" + strings.Repeat("0", 64)); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a bad signature, got %d", http.StatusUnauthorized, code)
+	}
+	code, resp := post("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+	if code != http.StatusAccepted {
+		t.Errorf("Expected status %d for a signed webhook, got %d", http.StatusAccepted, code)
+	}
+	if !strings.Contains(resp, `"partner":"acme"`) || !strings.Contains(resp, `"bytes":25`) {
+		t.Errorf("Expected handler to see the partner and body, got %s", resp)
+	}
+
+	cfg.Webhooks.SecretsFile = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for missing webhook secrets file")
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	cfg := loadConfig(t)
+	cfg.Server.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	cfg.RateLimit.RequestsPerSecond = 1
+
+	logs := &syncBuffer{}
+	srv, err := New(cfg, WithLogger(log.New(logs, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	getFrom := func(forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/version", http.NoBody)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /version: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := getFrom("192.0.2.7"); code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := getFrom("198.51.100.1"); code != http.StatusOK {
+		t.Errorf("Expected a separate rate limit per client, got %d", code)
+	}
+	// Prepending an address does not change the client the proxy saw
+	if code := getFrom("203.0.113.1, 192.0.2.7"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected spoofed request to share the client's limit, got %d", code)
+	}
+	if !strings.Contains(logs.String(), "GET /version 200") || !strings.Contains(logs.String(), " 192.0.2.7\n") {
+		t.Errorf("Expected client address in request log, got:\n%s", logs.String())
+	}
+}
+
+func TestStreamsSkipGlobalConcurrencyLimit(t *testing.T) {
+	cfg := loadConfig(t)
+	cfg.Overload.MaxConcurrent = 1
+	cfg.Overload.RouteLimits = map[string]int{"/api/v1/events": 1}
+	cfg.Overload.MaxQueue = 0
+
+	srv, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/events", http.NoBody)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/events: %v", err)
+	}
+	defer stream.Body.Close()
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("Expected stream status %d, got %d", http.StatusOK, stream.StatusCode)
+	}
+
+	// The open stream holds its route slot but not the global one
+	if code, _ := get(t, ts.URL+"/api/v1/hello"); code != http.StatusOK {
+		t.Errorf("Expected status %d with a stream open, got %d", http.StatusOK, code)
+	}
+	if code, _ := get(t, ts.URL+"/api/v1/events"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected second stream to be shed by its route limit, got %d", code)
+	}
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	tests := []struct {
+		name     string
+		cors     []string
+		origin   string
+		expected int
+	}{
+		{name: "listed origin", cors: []string{"https://app.*"}, origin: "https://app.example.com", expected: http.StatusSwitchingProtocols},
+		{name: "unlisted origin", cors: []string{"https://app.*"}, origin: "https://evil.test", expected: http.StatusForbidden},
+		{name: "default CORS is same-host only", origin: "https://evil.test", expected: http.StatusForbidden},
+		{name: "same host", origin: "self", expected: http.StatusSwitchingProtocols},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadConfig(t)
+			if tt.cors != nil {
+				cfg.CORS.AllowedOrigins = tt.cors
+			}
+			srv, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ts := httptest.NewServer(srv.Handler())
+			defer ts.Close()
+
+			origin := tt.origin
+			if origin == "self" {
+				origin = ts.URL
+			}
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/ws", http.NoBody)
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestDebugOutlivesWriteTimeout(t *testing.T) {
+	cfg := loadConfig(t)
+	cfg.Server.WriteTimeout = 500 * time.Millisecond
+	cfg.Debug.Enabled = true
+	cfg.Debug.Token = "secret"
+	ln := listen(t)
+
+	srv, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)), WithListener(ln))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Run(ctx)
+
+	for _, path := range []string{"/debug/pprof/profile?seconds=1", "/debug/pprof/trace?seconds=1"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+path, http.NoBody)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK || len(body) == 0 {
+			t.Errorf("GET %s: expected a complete profile, got status %d, %d bytes, %v", path, resp.StatusCode, len(body), err)
+		}
+	}
+}
+
+func TestInheritedPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		public  int
+		admin   int
+		wantErr bool
+	}{
+		{name: "named", names: []string{"admin", "http"}, public: 1, admin: 0},
+		{name: "unit name default", names: []string{"go-app.socket"}, public: 0, admin: -1},
+		{name: "two unnamed sockets", names: []string{"0", "1"}, public: 0, admin: 1},
+		{name: "admin only", names: []string{"admin"}, public: -1, admin: 0},
+		{name: "http second", names: []string{"go-app.socket", "http"}, public: 1, admin: -1},
+		{name: "unit name default for both", names: []string{"go-app.socket", "go-app.socket"}, public: 0, admin: 1},
+		{name: "none", public: -1, admin: -1},
+		{name: "duplicate http", names: []string{"http", "http"}, wantErr: true},
+		{name: "duplicate admin", names: []string{"http", "admin", "admin"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inherited listener.Inherited
+			for _, name := range tt.names {
+				inherited = append(inherited, listener.Named{Name: name, Listener: listen(t)})
+			}
+			defer inherited.Close()
+
+			public, admin, err := inheritedPositions(inherited)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error for duplicate names")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if public != tt.public || admin != tt.admin {
+				t.Errorf("Expected positions %d and %d, got %d and %d", tt.public, tt.admin, public, admin)
+			}
+		})
+	}
+}
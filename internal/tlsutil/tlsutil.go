@@ -0,0 +1,225 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options describes the TLS settings for a server.
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables client certificate verification against the CAs
+	// in this PEM bundle.
+	ClientCAFile string
+	// ClientAuth is one of "none", "request", "require-any",
+	// "verify-if-given" or "require". Empty defaults to "require" when a
+	// client CA is configured and "none" otherwise.
+	ClientAuth string
+	// MinVersion is "1.2" or "1.3". Empty defaults to "1.2".
+	MinVersion string
+	// CipherPolicy is "default" (Go's defaults), "intermediate" (Mozilla
+	// intermediate ECDHE/AEAD suites) or "modern" (TLS 1.3 only).
+	CipherPolicy string
+}
+
+// intermediateCipherSuites follows the Mozilla "intermediate" profile for
+// TLS 1.2. TLS 1.3 suites are not configurable in Go.
+var intermediateCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// NewConfig builds a server tls.Config whose certificate is served by the
+// returned CertReloader.
+func NewConfig(opts Options) (*tls.Config, *CertReloader, error) {
+	reloader, err := NewCertReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch opts.MinVersion {
+	case "", "1.2":
+		cfg.MinVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, nil, fmt.Errorf("unsupported TLS minimum version %q", opts.MinVersion)
+	}
+
+	switch opts.CipherPolicy {
+	case "", "default":
+	case "intermediate":
+		cfg.CipherSuites = intermediateCipherSuites
+	case "modern":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, nil, fmt.Errorf("unsupported TLS cipher policy %q", opts.CipherPolicy)
+	}
+
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+
+	auth, err := parseClientAuth(opts.ClientAuth, opts.ClientCAFile != "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if auth >= tls.VerifyClientCertIfGiven && cfg.ClientCAs == nil {
+		return nil, nil, errors.New("client certificate verification requires a client CA file")
+	}
+	cfg.ClientAuth = auth
+
+	return cfg, reloader, nil
+}
+
+func parseClientAuth(s string, haveCA bool) (tls.ClientAuthType, error) {
+	switch strings.ToLower(s) {
+	case "":
+		if haveCA {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require-any":
+		return tls.RequireAnyClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unsupported client auth mode %q", s)
+	}
+}
+
+// CertReloader serves a certificate/key pair and reloads it when the files
+// change on disk, so rotated certificates are picked up without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the initial certificate.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload reads the certificate and key from disk. On error the previous
+// certificate stays in use.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether either file was modified since the last load.
+func (r *CertReloader) changed() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime.Equal(r.modTime), nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Watch polls the files every interval and reloads them when they change,
+// until ctx is canceled. Polling (rather than inotify) also works with the
+// symlink swaps Kubernetes uses for mounted secrets. A non-positive interval
+// disables reloading.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	if interval <= 0 {
+		logger.Printf("tls: certificate reloading disabled, interval is %s", interval)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.changed()
+			if err != nil {
+				logger.Printf("tls: checking certificate: %v", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				logger.Printf("tls: reloading certificate: %v", err)
+				continue
+			}
+			logger.Printf("tls: reloaded certificate from %s", r.certFile)
+		}
+	}
+}
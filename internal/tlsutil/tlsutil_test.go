@@ -0,0 +1,249 @@
+package tlsutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate and key for commonName and
+// returns the parsed certificate.
+func writeCert(t *testing.T, certFile, keyFile, commonName string, isCA bool) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first", false)
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		r.Watch(ctx, 10*time.Millisecond, logger)
+		close(done)
+	}()
+
+	writeCert(t, certFile, keyFile, "second", false)
+	// Ensure the modification time moves even on coarse filesystems.
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ := r.GetCertificate(nil)
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && leaf.Subject.CommonName == "second" {
+			cancel()
+			<-done
+			if !strings.Contains(logs.String(), "reloaded certificate") {
+				t.Errorf("Expected reload to be logged, got %q", logs.String())
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Expected certificate to be reloaded")
+}
+
+func TestCertReloaderWatchZeroInterval(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first", false)
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var logs bytes.Buffer
+	// Returns immediately instead of panicking in time.NewTicker
+	r.Watch(context.Background(), 0, log.New(&logs, "", 0))
+	if !strings.Contains(logs.String(), "disabled") {
+		t.Errorf("Expected disabled reloading to be logged, got %q", logs.String())
+	}
+}
+
+func TestCertReloaderKeepsOldCertOnError(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first", false)
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Fatal("Expected error reloading invalid certificate")
+	}
+	if cert, _ := r.GetCertificate(nil); cert == nil {
+		t.Error("Expected previous certificate to remain in use")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "server", false)
+
+	tests := []struct {
+		name       string
+		opts       Options
+		minVersion uint16
+		ciphers    bool
+		wantErr    bool
+	}{
+		{"defaults", Options{}, tls.VersionTLS12, false, false},
+		{"intermediate", Options{CipherPolicy: "intermediate"}, tls.VersionTLS12, true, false},
+		{"modern", Options{CipherPolicy: "modern"}, tls.VersionTLS13, false, false},
+		{"tls13", Options{MinVersion: "1.3"}, tls.VersionTLS13, false, false},
+		{"bad version", Options{MinVersion: "1.0"}, 0, false, true},
+		{"bad policy", Options{CipherPolicy: "weak"}, 0, false, true},
+		{"verify without CA", Options{ClientAuth: "require"}, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.CertFile = certFile
+			tt.opts.KeyFile = keyFile
+
+			cfg, _, err := NewConfig(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.MinVersion != tt.minVersion {
+				t.Errorf("Expected min version %x, got %x", tt.minVersion, cfg.MinVersion)
+			}
+			if (len(cfg.CipherSuites) > 0) != tt.ciphers {
+				t.Errorf("Unexpected cipher suites %v", cfg.CipherSuites)
+			}
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := filepath.Join(dir, "server.crt")
+	serverKey := filepath.Join(dir, "server.key")
+	clientCert := filepath.Join(dir, "client.crt")
+	clientKey := filepath.Join(dir, "client.key")
+	server := writeCert(t, serverCert, serverKey, "server", true)
+	writeCert(t, clientCert, clientKey, "client", true)
+
+	cfg, _, err := NewConfig(Options{
+		CertFile:     serverCert,
+		KeyFile:      serverKey,
+		ClientCAFile: clientCert,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Expected client certificates to be required, got %v", cfg.ClientAuth)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server)
+
+	// httptest installs its own certificate in Certificates; sending SNI
+	// makes the server use GetCertificate from our config instead. Without a
+	// client certificate the handshake fails.
+	noCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	if resp, err := noCert.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected request without client certificate to fail")
+	}
+
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		Certificates: []tls.Certificate{pair},
+	}}}
+	resp, err := withCert.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
@@ -0,0 +1,193 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eminent85/go-app/internal/listener"
+)
+
+// Environment variables describing the handoff to the new process.
+const (
+	envListeners = "GO_APP_UPGRADE_LISTENERS"
+	envReadyFD   = "GO_APP_UPGRADE_READY_FD"
+)
+
+// envNotifySocket is the systemd notification socket, set for services
+// that may send notifications.
+const envNotifySocket = "NOTIFY_SOCKET"
+
+// firstFD is the descriptor of the first entry in exec.Cmd.ExtraFiles.
+const firstFD = 3
+
+// filer is implemented by *net.TCPListener and *net.UnixListener.
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Upgrading reports whether this process was started by Upgrade and has not
+// yet called Ready.
+func Upgrading() bool {
+	return os.Getenv(envReadyFD) != ""
+}
+
+// Inherited returns the listeners handed over by the parent process. It
+// returns none when the process was not started by Upgrade.
+func Inherited() (listener.Inherited, error) {
+	value := os.Getenv(envListeners)
+	os.Unsetenv(envListeners)
+	if value == "" {
+		return nil, nil
+	}
+	names := strings.Split(value, ":")
+	return listener.FromFiles(firstFD, len(names), names)
+}
+
+// Ready tells the parent process that this process is serving, so the
+// parent can start draining. It is a no-op when Upgrading is false.
+func Ready() error {
+	value := os.Getenv(envReadyFD)
+	os.Unsetenv(envReadyFD)
+	if value == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", envReadyFD, value)
+	}
+
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// Upgrade starts the current executable with the same arguments, passing
+// it listeners, and waits up to timeout for it to call Ready. On success the
+// new process is released and its PID returned; the caller should then stop
+// serving and shut down gracefully. On failure the new process is killed
+// and the caller keeps serving.
+func Upgrade(ctx context.Context, listeners map[string]net.Listener, timeout time.Duration) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("locating executable: %w", err)
+	}
+
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	files := make([]*os.File, 0, len(names)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		l, ok := listeners[name].(filer)
+		if !ok {
+			return 0, fmt.Errorf("listener %s cannot be handed over", name)
+		}
+		f, err := l.File()
+		if err != nil {
+			return 0, fmt.Errorf("listener %s: %w", name, err)
+		}
+		files = append(files, f)
+	}
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+	files = append(files, readyW)
+
+	cmd := exec.Command(exe, os.Args[1:]...) //nolint:gosec // re-executes this binary
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		envListeners+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(firstFD+len(names)),
+	)
+	err = cmd.Start()
+	restoreNonblock(listeners)
+	if err != nil {
+		return 0, fmt.Errorf("starting new process: %w", err)
+	}
+
+	// Only the child holds the write end now, so the read fails with EOF
+	// if it exits before becoming ready.
+	readyW.Close()
+	files = files[:len(files)-1]
+
+	readyErr := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := io.ReadFull(ready, b[:])
+		readyErr <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-readyErr:
+		if err == nil {
+			pid := cmd.Process.Pid
+			releaseUnixSockets(listeners)
+			return pid, cmd.Process.Release()
+		}
+		err = errors.New("new process exited before becoming ready")
+	case <-timer.C:
+		err = fmt.Errorf("new process not ready after %s", timeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	_ = cmd.Process.Kill()
+	if waitErr := cmd.Wait(); waitErr != nil {
+		err = fmt.Errorf("%w: %v", err, waitErr)
+	}
+	return 0, err
+}
+
+// NotifyMainPID tells systemd that pid is now the service's main process,
+// so it keeps supervising the new process after this one exits instead of
+// stopping the service. It is a no-op outside systemd.
+func NotifyMainPID(pid int) error {
+	addr := os.Getenv(envNotifySocket)
+	if addr == "" {
+		return nil
+	}
+	// Addresses starting with @ are abstract sockets, which net handles.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", envNotifySocket, err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("MAINPID=" + strconv.Itoa(pid)))
+	return err
+}
+
+// releaseUnixSockets keeps socket files on disk when this process closes
+// its listeners, since the new process is now serving on them.
+func releaseUnixSockets(listeners map[string]net.Listener) {
+	for _, l := range listeners {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+}
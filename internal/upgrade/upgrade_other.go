@@ -0,0 +1,18 @@
+//go:build !unix
+
+package upgrade
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+)
+
+// Watch is a no-op on platforms without SIGUSR2.
+func Watch(ctx context.Context, listeners map[string]net.Listener, timeout time.Duration, logger *log.Logger, upgraded func()) {
+	logger.Printf("upgrade: signal-triggered upgrades are not supported on this platform")
+}
+
+// restoreNonblock is not needed where descriptors cannot be handed over.
+func restoreNonblock(listeners map[string]net.Listener) {}
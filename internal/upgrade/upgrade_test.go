@@ -0,0 +1,153 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// envChildMode makes the test binary act as the upgraded process.
+const envChildMode = "GO_APP_UPGRADE_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(envChildMode); mode != "" {
+		runChild(mode)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runChild serves the inherited listener, reporting its PID, until killed.
+func runChild(mode string) {
+	if mode == "fail" {
+		os.Exit(3)
+	}
+
+	listeners, err := Inherited()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ln := listeners.TakeAt(listeners.Index("http"))
+	if ln == nil {
+		os.Exit(2)
+	}
+
+	go func() {
+		_ = http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, os.Getpid())
+		}))
+	}()
+	if err := Ready(); err != nil {
+		os.Exit(1)
+	}
+	time.Sleep(10 * time.Second)
+	os.Exit(0)
+}
+
+func TestUpgrade(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("descriptors cannot be handed to child processes on Windows")
+	}
+	t.Setenv(envChildMode, "serve")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	pid, err := Upgrade(context.Background(), map[string]net.Listener{"http": ln}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
+	}()
+
+	// The parent stops accepting; the child keeps serving on the same socket.
+	ln.Close()
+
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("Expected new process to serve, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != strconv.Itoa(pid) {
+		t.Errorf("Expected response from PID %d, got %q", pid, body)
+	}
+}
+
+func TestUpgradeChildFails(t *testing.T) {
+	t.Setenv(envChildMode, "fail")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if _, err := Upgrade(context.Background(), map[string]net.Listener{"http": ln}, 5*time.Second); err == nil {
+		t.Error("Expected error when the new process exits early")
+	}
+
+	// The parent's listener is still usable.
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected parent to keep serving, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNotifyMainPID(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("systemd notifications are not sent on Windows")
+	}
+
+	addr := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv(envNotifySocket, addr)
+
+	if err := NotifyMainPID(1234); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != "MAINPID=1234" {
+		t.Errorf("Expected MAINPID=1234, got %q", got)
+	}
+}
+
+func TestReadyWithoutUpgrade(t *testing.T) {
+	if Upgrading() {
+		t.Fatal("Expected Upgrading to be false")
+	}
+	if err := Ready(); err != nil {
+		t.Errorf("Expected no-op, got %v", err)
+	}
+	listeners, err := Inherited()
+	if err != nil || len(listeners) != 0 {
+		t.Errorf("Expected no inherited listeners, got %v %v", listeners, err)
+	}
+}
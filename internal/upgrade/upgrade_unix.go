@@ -0,0 +1,59 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Watch performs an Upgrade whenever the process receives SIGUSR2, until ctx
+// is canceled. After a successful upgrade it calls upgraded, which should
+// begin graceful shutdown, and returns.
+func Watch(ctx context.Context, listeners map[string]net.Listener, timeout time.Duration, logger *log.Logger, upgraded func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			logger.Printf("upgrade: starting new process")
+			pid, err := Upgrade(ctx, listeners, timeout)
+			if err != nil {
+				logger.Printf("upgrade: failed, continuing to serve: %v", err)
+				continue
+			}
+			logger.Printf("upgrade: process %d is ready, draining", pid)
+			if err := NotifyMainPID(pid); err != nil {
+				logger.Printf("upgrade: notifying systemd of the new main process: %v", err)
+			}
+			upgraded()
+			return
+		}
+	}
+}
+
+// restoreNonblock puts listeners back into non-blocking mode. Passing a
+// descriptor to a child process makes the shared file description blocking,
+// which would stall this process's accept loop and Close.
+func restoreNonblock(listeners map[string]net.Listener) {
+	for _, l := range listeners {
+		sc, ok := l.(syscall.Conn)
+		if !ok {
+			continue
+		}
+		if raw, err := sc.SyscallConn(); err == nil {
+			_ = raw.Control(func(fd uintptr) {
+				_ = syscall.SetNonblock(int(fd), true)
+			})
+		}
+	}
+}
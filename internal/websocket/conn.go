@@ -0,0 +1,398 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by RFC 6455 for the handshake
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+// Message types defined by RFC 6455.
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes defined by RFC 6455.
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+	CloseTryAgainLater    = 1013
+)
+
+const (
+	acceptGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlPayload = 125
+)
+
+var (
+	// ErrBadHandshake is returned when a request is not a valid upgrade.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrMessageTooBig is returned when a message exceeds the read limit.
+	ErrMessageTooBig = errors.New("websocket: message too big")
+	// ErrCloseSent is returned when writing after a close frame was sent.
+	ErrCloseSent = errors.New("websocket: close sent")
+)
+
+// CloseError is returned by ReadMessage when the peer sends a close frame.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+// protocolError is a peer violation; the connection is closed with Code.
+type protocolError struct {
+	Code int
+	Text string
+}
+
+func (e *protocolError) Error() string {
+	return "websocket: " + e.Text
+}
+
+// Conn is a server-side WebSocket connection.
+type Conn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	readLimit int64
+
+	wmu       sync.Mutex
+	closeSent bool
+
+	pongHandler func()
+}
+
+// Upgrade performs the opening handshake and hijacks the connection. The
+// caller must verify the origin before calling Upgrade. On failure an HTTP
+// error has already been written. Messages larger than readLimit are
+// rejected; a readLimit of zero or less uses DefaultMaxMessageSize, since
+// frame headers may declare lengths up to 2^63 bytes.
+func Upgrade(w http.ResponseWriter, r *http.Request, readLimit int64) (*Conn, error) {
+	if readLimit <= 0 {
+		readLimit = DefaultMaxMessageSize
+	}
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Upgrade Required", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+
+	// Clear deadlines inherited from the http.Server timeouts.
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return &Conn{
+		conn:      netConn,
+		br:        brw.Reader,
+		readLimit: readLimit,
+	}, nil
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for a client key.
+func acceptKey(key string) string {
+	h := sha1.New() //nolint:gosec // required by RFC 6455
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains reports whether a comma-separated header contains token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetPongHandler sets a function called when a pong frame arrives.
+func (c *Conn) SetPongHandler(fn func()) {
+	c.pongHandler = fn
+}
+
+// SetReadDeadline sets the deadline for the next read.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// ReadMessage reads the next data message, answering pings and close frames
+// along the way. It returns a *CloseError when the peer closes.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		msgType MessageType
+		payload []byte
+	)
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			var pe *protocolError
+			switch {
+			case errors.As(err, &pe):
+				_ = c.WriteClose(pe.Code, pe.Text, time.Now().Add(time.Second))
+			case errors.Is(err, ErrMessageTooBig):
+				_ = c.WriteClose(CloseMessageTooBig, "message too big", time.Now().Add(time.Second))
+			}
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, data, time.Now().Add(time.Second)); err != nil && !errors.Is(err, ErrCloseSent) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if c.pongHandler != nil {
+				c.pongHandler()
+			}
+			continue
+		case opClose:
+			ce := parseClose(data)
+			if len(data) > 0 && !validCloseCode(ce.Code) {
+				return 0, nil, c.fail(CloseProtocolError, "invalid close code")
+			}
+			if !utf8.ValidString(ce.Text) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+			}
+			// Echo the close frame unless we started the handshake.
+			_ = c.WriteClose(ce.Code, "", time.Now().Add(time.Second))
+			return 0, nil, ce
+		case opText, opBinary:
+			if msgType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message before previous finished")
+			}
+			msgType = MessageType(op)
+		case opContinuation:
+			if msgType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if int64(len(payload)+len(data)) > c.readLimit {
+			_ = c.WriteClose(CloseMessageTooBig, "message too big", time.Now().Add(time.Second))
+			return 0, nil, ErrMessageTooBig
+		}
+		payload = append(payload, data...)
+
+		if fin {
+			if msgType == TextMessage && !utf8.Valid(payload) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+			}
+			return msgType, payload, nil
+		}
+	}
+}
+
+// fail sends a close frame for a protocol violation and returns the error.
+func (c *Conn) fail(code int, text string) error {
+	_ = c.WriteClose(code, text, time.Now().Add(time.Second))
+	return &protocolError{Code: code, Text: text}
+}
+
+// readFrame reads a single frame and unmasks its payload.
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &protocolError{CloseProtocolError, "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &protocolError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		u := binary.BigEndian.Uint64(ext[:])
+		if u > 1<<62 {
+			return false, 0, nil, ErrMessageTooBig
+		}
+		length = int64(u)
+	}
+
+	if op >= opClose {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, &protocolError{CloseProtocolError, "invalid control frame"}
+		}
+	} else if length > c.readLimit {
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// parseClose decodes a close frame payload.
+func parseClose(data []byte) *CloseError {
+	if len(data) < 2 {
+		return &CloseError{Code: CloseNoStatusReceived}
+	}
+	return &CloseError{
+		Code: int(binary.BigEndian.Uint16(data[:2])),
+		Text: string(data[2:]),
+	}
+}
+
+// validCloseCode reports whether a peer may send code in a close frame.
+// 1005, 1006 and 1015 are reserved for reporting locally and never appear
+// on the wire; 3000-4999 are for libraries and applications.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// WriteMessage writes a data message as a single frame.
+func (c *Conn) WriteMessage(msgType MessageType, data []byte, deadline time.Time) error {
+	return c.writeFrame(byte(msgType), data, deadline)
+}
+
+// WritePing sends a ping control frame.
+func (c *Conn) WritePing(deadline time.Time) error {
+	return c.writeFrame(opPing, nil, deadline)
+}
+
+// WriteClose sends a close frame. Further writes fail with ErrCloseSent.
+func (c *Conn) WriteClose(code int, text string, deadline time.Time) error {
+	var payload []byte
+	if code != CloseNoStatusReceived {
+		if len(text) > maxControlPayload-2 {
+			text = text[:maxControlPayload-2]
+		}
+		payload = make([]byte, 2+len(text))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		copy(payload[2:], text)
+	}
+	return c.writeFrame(opClose, payload, deadline)
+}
+
+// writeFrame writes an unmasked frame; server frames are never masked.
+func (c *Conn) writeFrame(op byte, data []byte, deadline time.Time) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|op)
+	switch n := len(data); {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	bufs := net.Buffers{header, data}
+	_, err := bufs.WriteTo(c.conn)
+	return err
+}
+
+// Close closes the underlying network connection without a close frame.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,320 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eminent85/go-app/internal/metrics"
+)
+
+// Defaults applied to zero Options fields.
+const (
+	DefaultMaxMessageSize = 64 << 10
+	DefaultSendBufferSize = 32
+	DefaultPingInterval   = 30 * time.Second
+	DefaultPongTimeout    = 60 * time.Second
+	DefaultWriteTimeout   = 10 * time.Second
+)
+
+// Message is a data message sent or received on a connection.
+type Message struct {
+	Type MessageType
+	Data []byte
+}
+
+// Options configures a Hub.
+type Options struct {
+	// MaxMessageSize is the largest message accepted from clients; larger
+	// messages close the connection with status 1009.
+	MaxMessageSize int64
+	// SendBufferSize is the number of outgoing messages queued per
+	// connection. Clients that fall further behind are disconnected.
+	SendBufferSize int
+	// PingInterval is how often the server pings each client.
+	PingInterval time.Duration
+	// PongTimeout is how long to wait for any frame (including pongs)
+	// before the connection is considered dead.
+	PongTimeout time.Duration
+	// WriteTimeout bounds each frame write.
+	WriteTimeout time.Duration
+	// CheckOrigin rejects cross-origin upgrades with 403 when it returns
+	// false. Nil allows every origin.
+	CheckOrigin func(r *http.Request) bool
+	// OnMessage is called for every message received from a client.
+	OnMessage func(c *Client, msg Message)
+	// Metrics records connection and message counts when set.
+	Metrics *metrics.Metrics
+	// Logger receives connection errors. Defaults to log.Default().
+	Logger *log.Logger
+}
+
+// Hub accepts WebSocket connections and manages their lifecycle.
+type Hub struct {
+	opts Options
+
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewHub creates a Hub.
+func NewHub(opts Options) *Hub {
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if opts.SendBufferSize <= 0 {
+		opts.SendBufferSize = DefaultSendBufferSize
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = DefaultPingInterval
+	}
+	if opts.PongTimeout <= 0 {
+		opts.PongTimeout = DefaultPongTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultWriteTimeout
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+
+	return &Hub{
+		opts:    opts,
+		clients: make(map[*Client]struct{}),
+	}
+}
+
+// ServeHTTP upgrades the request and serves the connection until it closes.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.CheckOrigin != nil && !h.opts.CheckOrigin(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	h.wg.Add(1)
+	h.mu.Unlock()
+	defer h.wg.Done()
+
+	conn, err := Upgrade(w, r, h.opts.MaxMessageSize)
+	if err != nil {
+		if !errors.Is(err, ErrBadHandshake) {
+			h.opts.Logger.Printf("websocket: upgrade failed: %v", err)
+		}
+		return
+	}
+
+	c := &Client{
+		hub:     h,
+		conn:    conn,
+		send:    make(chan Message, h.opts.SendBufferSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		_ = conn.WriteClose(CloseGoingAway, "server shutting down", time.Now().Add(h.opts.WriteTimeout))
+		conn.Close()
+		return
+	}
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	if m := h.opts.Metrics; m != nil {
+		m.RecordWebSocketOpen()
+		defer m.RecordWebSocketClose()
+	}
+
+	c.serve()
+
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// Broadcast queues a message for every connected client.
+func (h *Hub) Broadcast(msg Message) {
+	h.mu.Lock()
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.Send(msg)
+	}
+}
+
+// Connections returns the number of open connections.
+func (h *Hub) Connections() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Shutdown stops accepting connections, sends a going-away close frame to
+// every client and waits for them to disconnect. Connections still open
+// when ctx expires are closed forcibly.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.Close(CloseGoingAway, "server shutting down")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		h.mu.Lock()
+		for c := range h.clients {
+			c.conn.Close()
+		}
+		h.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Client is a connection managed by a Hub.
+type Client struct {
+	hub  *Hub
+	conn *Conn
+	send chan Message
+
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+// Send queues a message without blocking. If the send buffer is full the
+// client is disconnected and Send returns false.
+func (c *Client) Send(msg Message) bool {
+	select {
+	case <-c.closing:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.Close(CloseTryAgainLater, "send buffer full")
+		return false
+	}
+}
+
+// Close starts the closing handshake with the given status code.
+func (c *Client) Close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.closing)
+	})
+}
+
+// serve runs the write loop in a goroutine and the read loop until the
+// connection ends.
+func (c *Client) serve() {
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+
+	c.readLoop()
+
+	close(c.done)
+	<-writerDone
+	c.conn.Close()
+}
+
+func (c *Client) readLoop() {
+	opts := c.hub.opts
+	_ = c.conn.SetReadDeadline(time.Now().Add(opts.PongTimeout))
+	c.conn.SetPongHandler(func() {
+		_ = c.conn.SetReadDeadline(time.Now().Add(opts.PongTimeout))
+	})
+
+	for {
+		msgType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case <-c.closing:
+			// Keep the shorter deadline set while closing.
+		default:
+			_ = c.conn.SetReadDeadline(time.Now().Add(opts.PongTimeout))
+		}
+
+		if m := opts.Metrics; m != nil {
+			m.RecordWebSocketMessage(true)
+		}
+		if opts.OnMessage != nil {
+			opts.OnMessage(c, Message{Type: msgType, Data: data})
+		}
+	}
+}
+
+func (c *Client) writeLoop() {
+	opts := c.hub.opts
+	ticker := time.NewTicker(opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.closing:
+			_ = c.conn.WriteClose(c.closeCode, c.closeText, time.Now().Add(opts.WriteTimeout))
+			// Give the peer a moment to answer before the read loop gives up.
+			_ = c.conn.SetReadDeadline(time.Now().Add(opts.WriteTimeout))
+			<-c.done
+			return
+		case <-ticker.C:
+			if err := c.conn.WritePing(time.Now().Add(opts.WriteTimeout)); err != nil {
+				c.conn.Close()
+				<-c.done
+				return
+			}
+		case msg := <-c.send:
+			if err := c.conn.WriteMessage(msg.Type, msg.Data, time.Now().Add(opts.WriteTimeout)); err != nil {
+				c.conn.Close()
+				<-c.done
+				return
+			}
+			if m := opts.Metrics; m != nil {
+				m.RecordWebSocketMessage(false)
+			}
+		}
+	}
+}
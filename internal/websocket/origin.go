@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowedOrigins returns an origin check matching the Origin header against
+// patterns in the same form as the CORS allowed origins: "*" allows every
+// origin and a single "*" inside a pattern matches any substring (for
+// example "https://*.example.com"). Requests without an Origin header come
+// from non-browser clients and are allowed, as are same-host requests.
+func AllowedOrigins(patterns []string) func(r *http.Request) bool {
+	normalized := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(p)))
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+
+		origin = strings.ToLower(origin)
+		for _, p := range normalized {
+			if matchOrigin(p, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchOrigin matches origin against a pattern with at most one wildcard.
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return pattern == origin
+	}
+	return len(origin) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
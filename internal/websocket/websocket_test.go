@@ -0,0 +1,416 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eminent85/go-app/internal/metrics"
+)
+
+// testClient is a minimal RFC 6455 client for exercising the server.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, srv *httptest.Server, origin string) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req := "GET / HTTP/1.1\r\n" +
+		"Host: " + strings.TrimPrefix(srv.URL, "http://") + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n"
+	if origin != "" {
+		req += "Origin: " + origin + "\r\n"
+	}
+	if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+		t.Fatalf("Failed to write handshake: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept %q", accept)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &testClient{t: t, conn: conn, br: br}
+}
+
+func (c *testClient) writeFrame(op byte, fin bool, payload []byte) {
+	c.t.Helper()
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+func (c *testClient) readFrame() (op byte, payload []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatalf("Failed to read frame: %v", err)
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("Server frames must not be masked")
+	}
+	n := int(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatalf("Failed to read payload: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func (c *testClient) expectClose(code int) {
+	c.t.Helper()
+	op, payload := c.readFrame()
+	if op != opClose {
+		c.t.Fatalf("Expected close frame, got opcode %d", op)
+	}
+	if got := int(binary.BigEndian.Uint16(payload)); got != code {
+		c.t.Fatalf("Expected close code %d, got %d", code, got)
+	}
+}
+
+func newEchoServer(t *testing.T, opts Options) (*Hub, *httptest.Server) {
+	t.Helper()
+	opts.OnMessage = func(c *Client, msg Message) {
+		c.Send(msg)
+	}
+	hub := NewHub(opts)
+	srv := httptest.NewServer(hub)
+	t.Cleanup(srv.Close)
+	return hub, srv
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %s", got)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	m := metrics.New()
+	hub, srv := newEchoServer(t, Options{Metrics: m})
+	c := dial(t, srv, "")
+
+	// A fragmented message is reassembled before delivery.
+	c.writeFrame(opText, false, []byte("hello "))
+	c.writeFrame(opContinuation, true, []byte("world"))
+
+	op, payload := c.readFrame()
+	if op != opText || string(payload) != "hello world" {
+		t.Errorf("Expected echoed text 'hello world', got opcode %d %q", op, payload)
+	}
+
+	if n := hub.Connections(); n != 1 {
+		t.Errorf("Expected 1 connection, got %d", n)
+	}
+	if n := m.WebSocketConnections(); n != 1 {
+		t.Errorf("Expected 1 active connection metric, got %d", n)
+	}
+
+	c.writeFrame(opClose, true, []byte{0x03, 0xE8})
+	c.expectClose(CloseNormalClosure)
+
+	deadline := time.Now().Add(time.Second)
+	for m.WebSocketConnections() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := m.WebSocketConnections(); n != 0 {
+		t.Errorf("Expected 0 active connections after close, got %d", n)
+	}
+	if received, sent := m.WebSocketMessages(); received != 1 || sent != 1 {
+		t.Errorf("Expected 1 message each way, got %d received and %d sent", received, sent)
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	_, srv := newEchoServer(t, Options{PingInterval: 20 * time.Millisecond})
+	c := dial(t, srv, "")
+
+	// Client pings are answered with a pong carrying the same payload.
+	c.writeFrame(opPing, true, []byte("abc"))
+	for {
+		op, payload := c.readFrame()
+		if op == opPing {
+			continue // server keepalive
+		}
+		if op != opPong || string(payload) != "abc" {
+			t.Fatalf("Expected pong 'abc', got opcode %d %q", op, payload)
+		}
+		break
+	}
+
+	// The server pings on its own.
+	for {
+		if op, _ := c.readFrame(); op == opPing {
+			break
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	_, srv := newEchoServer(t, Options{MaxMessageSize: 8})
+	c := dial(t, srv, "")
+
+	c.writeFrame(opBinary, true, []byte("0123456789"))
+	c.expectClose(CloseMessageTooBig)
+}
+
+func TestUpgradeDefaultReadLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, 0)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer srv.Close()
+	c := dial(t, srv, "")
+
+	// A header declaring a huge payload is rejected before any allocation.
+	frame := []byte{0x80 | opBinary, 0x80 | 127}
+	frame = binary.BigEndian.AppendUint64(frame, 1<<40)
+	if _, err := c.conn.Write(append(frame, 1, 2, 3, 4)); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	c.expectClose(CloseMessageTooBig)
+}
+
+func TestCloseCodeValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		reply   int
+	}{
+		{name: "normal", payload: []byte{0x03, 0xE8}, reply: CloseNormalClosure},
+		{name: "application", payload: []byte{0x0F, 0xA0}, reply: 4000},
+		{name: "no status on the wire", payload: []byte{0x03, 0xED}, reply: CloseProtocolError},
+		{name: "abnormal closure", payload: []byte{0x03, 0xEE}, reply: CloseProtocolError},
+		{name: "TLS handshake", payload: []byte{0x03, 0xF7}, reply: CloseProtocolError},
+		{name: "unassigned", payload: []byte{0x07, 0xD0}, reply: CloseProtocolError},
+		{name: "out of range", payload: []byte{0x13, 0x88}, reply: CloseProtocolError},
+		{name: "truncated", payload: []byte{0x03}, reply: CloseProtocolError},
+		{name: "invalid reason", payload: []byte{0x03, 0xE8, 0xFF}, reply: CloseInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newEchoServer(t, Options{})
+			c := dial(t, srv, "")
+
+			c.writeFrame(opClose, true, tt.payload)
+			c.expectClose(tt.reply)
+		})
+	}
+}
+
+func TestUnmaskedFrameRejected(t *testing.T) {
+	_, srv := newEchoServer(t, Options{})
+	c := dial(t, srv, "")
+
+	if _, err := c.conn.Write([]byte{0x81, 0x02, 'h', 'i'}); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	c.expectClose(CloseProtocolError)
+}
+
+func TestSlowClientDisconnected(t *testing.T) {
+	hub := NewHub(Options{SendBufferSize: 1})
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+	c := dial(t, srv, "")
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Connections() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Flood the hub without reading; the client is eventually dropped.
+	for i := 0; i < 1000 && hub.Connections() > 0; i++ {
+		hub.Broadcast(Message{Type: BinaryMessage, Data: make([]byte, 64<<10)})
+	}
+
+	for {
+		op, payload := c.readFrame()
+		if op == opClose {
+			if code := int(binary.BigEndian.Uint16(payload)); code != CloseTryAgainLater {
+				t.Errorf("Expected close code %d, got %d", CloseTryAgainLater, code)
+			}
+			return
+		}
+	}
+}
+
+func TestOriginCheck(t *testing.T) {
+	hub := NewHub(Options{CheckOrigin: AllowedOrigins([]string{"https://*.example.com"})})
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, http.NoBody)
+	req.Header.Set("Origin", "https://evil.test")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	dial(t, srv, "https://app.example.com")
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	check := AllowedOrigins([]string{"https://*", "http://localhost:3000"})
+
+	tests := []struct {
+		origin  string
+		host    string
+		allowed bool
+	}{
+		{"", "api.test", true},
+		{"https://anything.test", "api.test", true},
+		{"http://localhost:3000", "api.test", true},
+		{"http://localhost:4000", "api.test", false},
+		{"http://api.test", "api.test", true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Host = tt.host
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := check(req); got != tt.allowed {
+			t.Errorf("Origin %q: expected %v, got %v", tt.origin, tt.allowed, got)
+		}
+	}
+}
+
+func TestBadHandshake(t *testing.T) {
+	hub := NewHub(Options{})
+
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestUpgradeFailureLogged(t *testing.T) {
+	var logs bytes.Buffer
+	hub := NewHub(Options{Logger: log.New(&logs, "", 0)})
+
+	// A recorder cannot be hijacked.
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	hub.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logs.String(), "websocket: upgrade failed") {
+		t.Errorf("Expected upgrade failure in the injected logger, got %q", logs.String())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	hub, srv := newEchoServer(t, Options{})
+	c := dial(t, srv, "")
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Connections() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		errc <- hub.Shutdown(ctx)
+	}()
+
+	c.expectClose(CloseGoingAway)
+	c.writeFrame(opClose, true, []byte{0x03, 0xE9})
+
+	if err := <-errc; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+	if n := hub.Connections(); n != 0 {
+		t.Errorf("Expected 0 connections after shutdown, got %d", n)
+	}
+
+	// New upgrades are refused once the hub is closed.
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
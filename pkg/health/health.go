@@ -1,11 +1,20 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// MediaTypeHealthJSON is the media type defined by the IETF health check
+// response format draft (draft-inadarei-api-health-check).
+const MediaTypeHealthJSON = "application/health+json"
+
 // Status represents the health status.
 type Status string
 
@@ -14,6 +23,27 @@ const (
 	StatusUnhealthy Status = "unhealthy"
 )
 
+// CheckStatus represents a status value in the health+json format.
+type CheckStatus string
+
+const (
+	StatusPass CheckStatus = "pass"
+	StatusWarn CheckStatus = "warn"
+	StatusFail CheckStatus = "fail"
+)
+
+// severity orders check statuses so the worst one can be selected.
+func (s CheckStatus) severity() int {
+	switch s {
+	case StatusPass:
+		return 0
+	case StatusWarn:
+		return 1
+	default:
+		return 2
+	}
+}
+
 // Response represents a health check response.
 type Response struct {
 	Status    Status    `json:"status"`
@@ -22,22 +52,220 @@ type Response struct {
 	Uptime    string    `json:"uptime,omitempty"`
 }
 
-// Handler returns an HTTP handler for health checks.
-func Handler(version string, startTime time.Time) http.HandlerFunc {
+// Check is a single component measurement in a health+json response.
+type Check struct {
+	ComponentID   string      `json:"componentId,omitempty"`
+	ComponentType string      `json:"componentType,omitempty"`
+	ObservedValue any         `json:"observedValue,omitempty"`
+	ObservedUnit  string      `json:"observedUnit,omitempty"`
+	Status        CheckStatus `json:"status"`
+	Time          time.Time   `json:"time"`
+	Output        string      `json:"output,omitempty"`
+}
+
+// CheckFunc performs a health check. Its key in the checks map follows the
+// draft's "componentName:measurementName" convention.
+type CheckFunc func(ctx context.Context) Check
+
+// HealthJSON represents a response in the health+json format.
+type HealthJSON struct {
+	Status      CheckStatus        `json:"status"`
+	Version     string             `json:"version,omitempty"`
+	ReleaseID   string             `json:"releaseId,omitempty"`
+	ServiceID   string             `json:"serviceId,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Output      string             `json:"output,omitempty"`
+	Checks      map[string][]Check `json:"checks,omitempty"`
+}
+
+// Option configures the health handler.
+type Option func(*options)
+
+type options struct {
+	releaseID   string
+	serviceID   string
+	description string
+	checks      map[string]CheckFunc
+}
+
+// WithReleaseID sets the releaseId reported in health+json responses,
+// typically the commit the binary was built from.
+func WithReleaseID(id string) Option {
+	return func(o *options) {
+		o.releaseID = id
+	}
+}
+
+// WithServiceID sets the serviceId reported in health+json responses.
+func WithServiceID(id string) Option {
+	return func(o *options) {
+		o.serviceID = id
+	}
+}
+
+// WithDescription sets the human-friendly service description.
+func WithDescription(description string) Option {
+	return func(o *options) {
+		o.description = description
+	}
+}
+
+// WithCheck registers a named check included in every health response.
+func WithCheck(name string, fn CheckFunc) Option {
+	return func(o *options) {
+		o.checks[name] = fn
+	}
+}
+
+// Handler returns an HTTP handler for health checks. Clients that accept
+// application/health+json receive the IETF draft format; everyone else gets
+// the plain JSON Response.
+func Handler(version string, startTime time.Time, opts ...Option) http.HandlerFunc {
+	o := &options{checks: make(map[string]CheckFunc)}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		uptime := time.Since(startTime)
+		w.Header().Set("Vary", "Accept")
+
+		checks := map[string][]Check{
+			"uptime": {{
+				ComponentType: "system",
+				ObservedValue: uptime.Seconds(),
+				ObservedUnit:  "s",
+				Status:        StatusPass,
+				Time:          now,
+			}},
+		}
+		for name, fn := range o.checks {
+			check := fn(r.Context())
+			if check.Time.IsZero() {
+				check.Time = now
+			}
+			checks[name] = append(checks[name], check)
+		}
+		status := aggregate(checks)
+
+		code := http.StatusOK
+		if status == StatusFail {
+			code = http.StatusServiceUnavailable
+		}
+
+		if acceptsHealthJSON(r) {
+			response := HealthJSON{
+				Status:      status,
+				Version:     version,
+				ReleaseID:   o.releaseID,
+				ServiceID:   o.serviceID,
+				Description: o.description,
+				Checks:      checks,
+			}
+			if status != StatusPass {
+				response.Output = failingOutput(checks)
+			}
+
+			w.Header().Set("Content-Type", MediaTypeHealthJSON)
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(code)
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+
 		response := Response{
 			Status:    StatusHealthy,
-			Timestamp: time.Now(),
+			Timestamp: now,
 			Version:   version,
-			Uptime:    time.Since(startTime).String(),
+			Uptime:    uptime.String(),
+		}
+		if status == StatusFail {
+			response.Status = StatusUnhealthy
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(code)
 		_ = json.NewEncoder(w).Encode(response)
 	}
 }
 
+// aggregate returns the worst status across all checks.
+func aggregate(checks map[string][]Check) CheckStatus {
+	status := StatusPass
+	for _, list := range checks {
+		for _, c := range list {
+			if c.Status.severity() > status.severity() {
+				status = c.Status
+			}
+		}
+	}
+	return status
+}
+
+// failingOutput summarizes the checks that did not pass.
+func failingOutput(checks map[string][]Check) string {
+	var names []string
+	for name, list := range checks {
+		for _, c := range list {
+			if c.Status != StatusPass {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return "checks not passing: " + strings.Join(names, ", ")
+}
+
+// acceptsHealthJSON reports whether the request explicitly accepts the
+// health+json media type with a non-zero q-value, and does not give plain
+// JSON a higher one. Wildcards only count towards plain JSON.
+func acceptsHealthJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	healthQ, exact := AcceptQuality(accept, MediaTypeHealthJSON)
+	jsonQ, _ := AcceptQuality(accept, "application/json")
+	return exact && healthQ > 0 && healthQ >= jsonQ
+}
+
+// AcceptQuality returns the q-value an Accept header gives mediaType, taken
+// from the most specific matching media range, or 0 if none matches. exact
+// reports whether that range names mediaType rather than a wildcard.
+func AcceptQuality(accept, mediaType string) (q float64, exact bool) {
+	group, _, _ := strings.Cut(mediaType, "/")
+	specificity := -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		var s int
+		switch mediaRange {
+		case mediaType:
+			s = 2
+		case group + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		rangeQ := 1.0
+		if v, ok := params["q"]; ok {
+			if rangeQ, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if s > specificity {
+			q, specificity = rangeQ, s
+		} else if s == specificity {
+			q = max(q, rangeQ)
+		}
+	}
+	return q, specificity == 2
+}
+
 // ReadinessHandler returns an HTTP handler for readiness checks.
 func ReadinessHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -1,6 +1,7 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -78,3 +79,151 @@ func TestLivenessHandler(t *testing.T) {
 		t.Errorf("Expected body 'alive', got '%s'", body)
 	}
 }
+
+func TestHandlerHealthJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/health", http.NoBody)
+	req.Header.Set("Accept", "application/health+json, application/json;q=0.9")
+	w := httptest.NewRecorder()
+
+	handler := Handler("1.0.0", time.Now(), WithReleaseID("abc123"), WithServiceID("go-app"))
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != MediaTypeHealthJSON {
+		t.Errorf("Expected Content-Type %s, got %s", MediaTypeHealthJSON, ct)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Expected Vary: Accept, got %q", vary)
+	}
+
+	var response HealthJSON
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Status != StatusPass {
+		t.Errorf("Expected status %s, got %s", StatusPass, response.Status)
+	}
+
+	if response.ReleaseID != "abc123" {
+		t.Errorf("Expected releaseId abc123, got %s", response.ReleaseID)
+	}
+
+	if response.ServiceID != "go-app" {
+		t.Errorf("Expected serviceId go-app, got %s", response.ServiceID)
+	}
+
+	if _, ok := response.Checks["uptime"]; !ok {
+		t.Error("Expected uptime check to be present")
+	}
+}
+
+func TestAcceptsHealthJSON(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/health+json", true},
+		{"application/health+json;q=0", false},
+		{"application/health+json;q=0, application/json", false},
+		{"application/health+json;q=0.5, application/json", false},
+		{"application/health+json;q=0.5, application/json;q=0.5", true},
+		{"application/health+json;q=0.5, application/json;q=0.1, */*", true},
+		{"application/health+json;q=0.5, */*", false},
+		{"application/health+json;q=invalid", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/health", http.NoBody)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := acceptsHealthJSON(req); got != tt.expected {
+			t.Errorf("Accept %q: expected %v, got %v", tt.accept, tt.expected, got)
+		}
+	}
+}
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		accept    string
+		mediaType string
+		q         float64
+		exact     bool
+	}{
+		{"", "application/json", 0, false},
+		{"*/*", "application/json", 1, false},
+		{"application/*;q=0.5, */*;q=0.8", "application/json", 0.5, false},
+		{"application/json;q=0.2, application/*", "application/json", 0.2, true},
+		{"application/json;q=0.2, application/json;q=0.4", "application/json", 0.4, true},
+		{"text/plain;q=0.9", "application/json", 0, false},
+		{"application/json;q=bad, */*;q=0.1", "application/json", 0.1, false},
+	}
+
+	for _, tt := range tests {
+		q, exact := AcceptQuality(tt.accept, tt.mediaType)
+		if q != tt.q || exact != tt.exact {
+			t.Errorf("Accept %q: expected %v (exact %v), got %v (exact %v)", tt.accept, tt.q, tt.exact, q, exact)
+		}
+	}
+}
+
+func TestHandlerChecks(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         CheckStatus
+		expectedCode   int
+		expectedStatus Status
+	}{
+		{"pass", StatusPass, http.StatusOK, StatusHealthy},
+		{"warn", StatusWarn, http.StatusOK, StatusHealthy},
+		{"fail", StatusFail, http.StatusServiceUnavailable, StatusUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := WithCheck("db:connections", func(ctx context.Context) Check {
+				return Check{ComponentType: "datastore", Status: tt.status}
+			})
+			handler := Handler("1.0.0", time.Now(), check)
+
+			req := httptest.NewRequest(http.MethodGet, "/health", http.NoBody)
+			req.Header.Set("Accept", MediaTypeHealthJSON)
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+
+			var response HealthJSON
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, response.Status)
+			}
+			if len(response.Checks["db:connections"]) != 1 {
+				t.Errorf("Expected db:connections check in response")
+			}
+
+			// Plain JSON clients see the same outcome in the legacy format.
+			req = httptest.NewRequest(http.MethodGet, "/health", http.NoBody)
+			w = httptest.NewRecorder()
+			handler(w, req)
+
+			var legacy Response
+			if err := json.NewDecoder(w.Body).Decode(&legacy); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if legacy.Status != tt.expectedStatus {
+				t.Errorf("Expected status %s, got %s", tt.expectedStatus, legacy.Status)
+			}
+		})
+	}
+}